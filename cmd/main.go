@@ -3,13 +3,18 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"flag"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
-	"strconv"
 	"syscall"
+	"time"
 
+	"google.golang.org/grpc"
 	"sigs.k8s.io/container-object-storage-interface-provisioner-sidecar/pkg/provisioner"
 
 	"github.com/deepmap/oapi-codegen/pkg/securityprovider"
@@ -17,20 +22,31 @@ import (
 	"github.com/mpreu/cosi-driver-garage/internal/client"
 	"github.com/mpreu/cosi-driver-garage/internal/config"
 	"github.com/mpreu/cosi-driver-garage/internal/driver"
+	"github.com/mpreu/cosi-driver-garage/internal/health"
+	"github.com/mpreu/cosi-driver-garage/internal/httpserver"
+	"github.com/mpreu/cosi-driver-garage/internal/metrics"
+	"github.com/mpreu/cosi-driver-garage/internal/retry"
+	"github.com/mpreu/cosi-driver-garage/internal/tlsconfig"
+	"github.com/mpreu/cosi-driver-garage/internal/token"
+	"github.com/mpreu/cosi-driver-garage/internal/tracing"
 )
 
 func main() {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
-	cfg := config.Config{
-		COSIEndpoint: getEnv("COSI_ENDPOINT", "unix:///var/lib/cosi/cosi.sock"),
-		DriverName:   getEnv("X_COSI_DRIVER_NAME", "garage.objectstorage.k8s.io"),
-		Garage: &config.Garage{
-			Endpoint:           getEnv("GARAGE_ENDPOINT", ""),
-			Region:             getEnv("GARAGE_REGION", ""),
-			AdminEndpoint:      getEnv("GARAGE_ADMIN_ENDPOINT", ""),
-			AdminToken:         getEnv("GARAGE_ADMIN_TOKEN", ""),
-			InsecureSkipVerify: asBool(getEnv("GARAGE_INSECURE_SKIP_VERIFY", "false")),
-		},
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	printConfig := fs.Bool("print-config", false, "Print the effective configuration with secrets redacted and exit.")
+
+	cfg, err := config.Load(fs, os.Args[1:])
+	if err != nil {
+		logger.Error("Error loading config", "error", err)
+		os.Exit(1)
+	}
+
+	if *printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			logger.Error("Error printing config", "error", err)
+			os.Exit(1)
+		}
 	}
 
 	if err := cfg.Validate(); err != nil {
@@ -38,7 +54,11 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := run(context.Background(), &cfg, logger); err != nil {
+	if *printConfig {
+		return
+	}
+
+	if err := run(context.Background(), cfg, logger); err != nil {
 		logger.Error("Error running the driver", "error", err)
 		os.Exit(1)
 	}
@@ -52,49 +72,219 @@ func run(ctx context.Context, cfg *config.Config, logger *slog.Logger) error {
 	)
 	defer stop()
 
+	shutdownTracing, err := tracing.Setup(ctx, cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing()
+
 	// Setup Garage HTTP client.
-	tokenProvider, err := securityprovider.NewSecurityProviderBearerToken(cfg.Garage.AdminToken)
+	tokenEditor, err := adminToken(ctx, cfg.Garage, logger)
+	if err != nil {
+		return err
+	}
+
+	tlsMinVersion, err := tlsconfig.ParseVersion(cfg.Garage.TLSMinVersion)
+	if err != nil {
+		return err
+	}
+
+	adminURL, err := url.Parse(cfg.Garage.AdminEndpoint)
 	if err != nil {
+		return fmt.Errorf("error parsing admin endpoint: %w", err)
+	}
+
+	certs, err := tlsconfig.New(tlsconfig.Options{
+		CAFile:             cfg.Garage.CAFile,
+		CertFile:           cfg.Garage.ClientCertFile,
+		KeyFile:            cfg.Garage.ClientKeyFile,
+		ServerName:         cfg.Garage.TLSServerName,
+		Host:               adminURL.Hostname(),
+		MinVersion:         tlsMinVersion,
+		InsecureSkipVerify: cfg.Garage.InsecureSkipVerify,
+	}, logger)
+	if err != nil {
+		return err
+	}
+
+	// Reload certificates when mounted files are rotated.
+	if err := certs.Watch(ctx); err != nil {
 		return err
 	}
 
 	c, err := client.NewClientWithResponses(cfg.Garage.AdminEndpoint,
-		client.WithHTTPClient(&http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: cfg.Garage.InsecureSkipVerify,
-				},
-			},
-		}),
-		client.WithRequestEditorFn(tokenProvider.Intercept),
+		client.WithHTTPClient(httpClient(cfg.Garage, certs.Config())),
+		client.WithRequestEditorFn(tokenEditor),
 	)
 	if err != nil {
 		return err
 	}
 
+	// Serve health endpoints before the startup check, so that the driver is live but not ready.
+	// The cluster health is shared by the readiness and admission checks.
+	clusterHealth := health.NewCache(c, cfg.HealthCacheDuration)
+
+	probes := health.NewServer(clusterHealth, logger)
+	if err := serveHTTP(ctx, cfg, probes, logger); err != nil {
+		return err
+	}
+
+	// Export the cluster state also while the startup check fails.
+	if cfg.ClusterMetricsInterval > 0 {
+		cluster := metrics.NewClusterCollector(c, logger)
+		if err := metrics.Registry.Register(cluster); err != nil {
+			return err
+		}
+
+		go cluster.Run(ctx, cfg.ClusterMetricsInterval)
+	}
+
+	if err := startupCheck(ctx, cfg, c, logger); err != nil {
+		return err
+	}
+
 	// Run COSI server.
-	is, ps := driver.New(cfg.DriverName, cfg.Garage, c, logger)
+	is, ps, err := driver.New(ctx, cfg, c, clusterHealth, logger)
+	if err != nil {
+		return err
+	}
+
+	if cfg.BucketMetricsInterval > 0 {
+		prefix, err := driver.BucketAliasPrefix(cfg)
+		if err != nil {
+			return err
+		}
+
+		buckets := metrics.NewBucketCollector(c, prefix, cfg.BucketMetricsConcurrency, logger)
+		if err := metrics.Registry.Register(buckets); err != nil {
+			return err
+		}
+
+		go buckets.Run(ctx, cfg.BucketMetricsInterval)
+	}
 
-	server, err := provisioner.NewDefaultCOSIProvisionerServer(
+	server, err := provisioner.NewCOSIProvisionerServer(
 		cfg.COSIEndpoint,
 		is,
 		ps,
+		[]grpc.ServerOption{
+			tracing.ServerOption(),
+			grpc.ChainUnaryInterceptor(
+				driver.MetricsInterceptor(),
+				driver.DeadlineInterceptor(cfg.RPCTimeout),
+			),
+		},
 	)
 	if err != nil {
 		return err
 	}
 
+	probes.SetServing(true)
+	defer probes.SetServing(false)
+
 	return server.Run(ctx)
 }
 
-func getEnv(key, fallback string) string {
-	if value, ok := os.LookupEnv(key); ok {
-		return value
+// serveHTTP serves the enabled health and metrics endpoints.
+// Endpoints configured with the same address share a listener.
+func serveHTTP(ctx context.Context, cfg *config.Config, probes *health.Server, logger *slog.Logger) error {
+	muxes := map[string]*http.ServeMux{}
+	mux := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+
+		return muxes[addr]
 	}
-	return fallback
+
+	if cfg.HealthAddress != "" {
+		mux(cfg.HealthAddress).Handle("/", probes.Handler())
+	}
+
+	if cfg.MetricsAddress != "" {
+		mux(cfg.MetricsAddress).Handle("GET /metrics", metrics.Handler())
+	}
+
+	for addr, h := range muxes {
+		if err := httpserver.Start(ctx, addr, h, logger); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func asBool(v string) bool {
-	b, _ := strconv.ParseBool(v)
-	return b
+// startupCheck checks the Garage admin API before serving COSI requests.
+// Depending on the configuration, a failed check is returned or retried until it succeeds.
+func startupCheck(ctx context.Context, cfg *config.Config, c client.ClientWithResponsesInterface, logger *slog.Logger) error {
+	for {
+		err := driver.SelfCheck(ctx, c)
+		if err == nil {
+			logger.Info("Garage admin API check succeeded")
+			return nil
+		}
+
+		if cfg.StartupCheck != config.StartupCheckRetry || ctx.Err() != nil {
+			return fmt.Errorf("Garage admin API check failed: %w", err)
+		}
+
+		logger.Warn("Garage admin API check failed, retrying", "error", err, "interval", cfg.StartupRetryInterval.String())
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(cfg.StartupRetryInterval):
+		}
+	}
+}
+
+// adminToken returns a request editor adding the Garage admin token.
+// A token file is reloaded when it changes.
+func adminToken(ctx context.Context, cfg *config.Garage, logger *slog.Logger) (client.RequestEditorFn, error) {
+	if cfg.AdminTokenFile == "" {
+		p, err := securityprovider.NewSecurityProviderBearerToken(cfg.AdminToken)
+		if err != nil {
+			return nil, err
+		}
+
+		return p.Intercept, nil
+	}
+
+	f, err := token.NewFile(cfg.AdminTokenFile, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.Watch(ctx); err != nil {
+		return nil, err
+	}
+
+	return f.Intercept, nil
+}
+
+// httpClient returns the HTTP client for the Garage admin API.
+func httpClient(cfg *config.Garage, tlsConfig *tls.Config) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   cfg.ConnectTimeout,
+		KeepAlive: cfg.KeepAlive,
+	}
+
+	return &http.Client{
+		Timeout: cfg.RequestTimeout,
+		Transport: &retry.Transport{
+			// Metrics and spans are recorded for each attempt.
+			Next: &metrics.Transport{
+				Next: tracing.Transport(&http.Transport{
+					Proxy:                 http.ProxyFromEnvironment,
+					DialContext:           dialer.DialContext,
+					TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+					ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+					MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+					IdleConnTimeout:       cfg.IdleConnTimeout,
+					TLSClientConfig:       tlsConfig,
+				}),
+			},
+			Policy: cfg.RetryPolicy(),
+		},
+	}
 }
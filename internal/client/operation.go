@@ -0,0 +1,53 @@
+package client
+
+import (
+	"net/http"
+	"strings"
+)
+
+// operations maps Garage admin API requests to the operation names of the client.
+// Paths are matched as suffix, since the admin endpoint may include a base path.
+var operations = []struct {
+	method string
+	path   string
+	list   bool
+	name   string
+}{
+	{http.MethodGet, "/bucket", true, "ListBuckets"},
+	{http.MethodGet, "/bucket", false, "GetBucketInfo"},
+	{http.MethodPost, "/bucket", false, "CreateBucket"},
+	{http.MethodPut, "/bucket", false, "UpdateBucket"},
+	{http.MethodDelete, "/bucket", false, "DeleteBucket"},
+	{http.MethodPut, "/bucket/alias/global", false, "PutBucketGlobalAlias"},
+	{http.MethodDelete, "/bucket/alias/global", false, "DeleteBucketGlobalAlias"},
+	{http.MethodPut, "/bucket/alias/local", false, "PutBucketLocalAlias"},
+	{http.MethodDelete, "/bucket/alias/local", false, "DeleteBucketLocalAlias"},
+	{http.MethodPost, "/bucket/allow", false, "AllowBucketKey"},
+	{http.MethodPost, "/bucket/deny", false, "DenyBucketKey"},
+	{http.MethodPost, "/connect", false, "AddNode"},
+	{http.MethodGet, "/health", false, "GetHealth"},
+	{http.MethodGet, "/key", true, "ListKeys"},
+	{http.MethodPost, "/key", true, "AddKey"},
+	{http.MethodGet, "/key", false, "GetKey"},
+	{http.MethodPost, "/key", false, "UpdateKey"},
+	{http.MethodDelete, "/key", false, "DeleteKey"},
+	{http.MethodPost, "/key/import", false, "ImportKey"},
+	{http.MethodGet, "/layout", false, "GetLayout"},
+	{http.MethodPost, "/layout", false, "AddLayout"},
+	{http.MethodPost, "/layout/apply", false, "ApplyLayout"},
+	{http.MethodPost, "/layout/revert", false, "RevertLayout"},
+	{http.MethodGet, "/status", false, "GetNodes"},
+}
+
+// Operation returns the operation name of a Garage admin API request.
+func Operation(req *http.Request) string {
+	list := req.URL.Query().Has("list")
+
+	for _, o := range operations {
+		if req.Method == o.method && o.list == list && strings.HasSuffix(req.URL.Path, o.path) {
+			return o.name
+		}
+	}
+
+	return "unknown"
+}
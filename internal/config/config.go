@@ -1,52 +1,424 @@
 package config
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mpreu/cosi-driver-garage/internal/naming"
+	"github.com/mpreu/cosi-driver-garage/internal/retry"
+	"github.com/mpreu/cosi-driver-garage/internal/tlsconfig"
+)
+
+// Behaviors if the startup check fails.
+const (
+	// StartupCheckExit terminates the driver.
+	StartupCheckExit = "exit"
+	// StartupCheckRetry retries the check until it succeeds without serving COSI requests.
+	StartupCheckRetry = "retry"
+)
+
+// Admission policies for mutating requests while the Garage cluster lacks quorum
+// or has staged layout changes.
+const (
+	// AdmissionStrict refuses requests with codes.Unavailable.
+	AdmissionStrict = "strict"
+	// AdmissionWarn logs a warning and admits requests.
+	AdmissionWarn = "warn"
+	// AdmissionOff disables the check.
+	AdmissionOff = "off"
+)
+
+// Trace exporters.
+const (
+	// TracingExporterNone disables tracing.
+	TracingExporterNone = "none"
+	// TracingExporterOTLP exports spans with OTLP over gRPC, configured with OTEL_EXPORTER_OTLP_* variables.
+	TracingExporterOTLP = "otlp"
+	// TracingExporterStdout writes spans to stdout for debugging.
+	TracingExporterStdout = "stdout"
+	// TracingExporterFile appends spans to TracingFile for debugging.
+	TracingExporterFile = "file"
+)
 
 // Config options for the driver.
 type Config struct {
-	COSIEndpoint string
-	DriverName   string
-	Garage       *Garage
+	COSIEndpoint string `yaml:"cosiEndpoint" env:"COSI_ENDPOINT"`
+	DriverName   string `yaml:"driverName" env:"X_COSI_DRIVER_NAME"`
+	// BucketIndex enables an in-memory index of bucket aliases to IDs,
+	// which is filled at startup.
+	BucketIndex bool `yaml:"bucketIndex" env:"BUCKET_INDEX"`
+	// PermissionProfiles are additional named permission presets for BucketAccessClasses.
+	PermissionProfiles map[string]Permissions `yaml:"permissionProfiles" env:"PERMISSION_PROFILES"`
+	// AllowCreateBucket permits BucketAccessClasses to grant keys the permission to create buckets.
+	AllowCreateBucket bool `yaml:"allowCreateBucket" env:"ALLOW_CREATE_BUCKET"`
+	// KeyNameTemplate is a Go template for Garage key names.
+	// Available fields are .DriverName, .BucketID and .AccountName, which is required.
+	KeyNameTemplate string `yaml:"keyNameTemplate" env:"KEY_NAME_TEMPLATE"`
+	// BucketAliasTemplate is a Go template for Garage bucket global aliases.
+	// Available fields are .ClusterName, .DriverName and .Name, which is required.
+	BucketAliasTemplate string `yaml:"bucketAliasTemplate" env:"BUCKET_ALIAS_TEMPLATE"`
+	// ClusterName identifies the Kubernetes cluster in bucket alias templates.
+	ClusterName string `yaml:"clusterName" env:"CLUSTER_NAME"`
+	// RPCTimeout is the default deadline of COSI requests without a deadline.
+	RPCTimeout time.Duration `yaml:"rpcTimeout" env:"RPC_TIMEOUT"`
+	// StartupCheck is the behavior if the Garage admin API check at startup fails,
+	// StartupCheckExit or StartupCheckRetry.
+	StartupCheck string `yaml:"startupCheck" env:"STARTUP_CHECK"`
+	// StartupRetryInterval is the wait time between startup checks with StartupCheckRetry.
+	StartupRetryInterval time.Duration `yaml:"startupRetryInterval" env:"STARTUP_RETRY_INTERVAL"`
+	// HealthAddress is the listen address of the health endpoints, e.g. ":8080".
+	// The endpoints are disabled if it is empty.
+	HealthAddress string `yaml:"healthAddress" env:"HEALTH_ADDRESS"`
+	// HealthCacheDuration is how long the Garage cluster health is cached for readiness and admission checks,
+	// and the cluster layout for admission checks.
+	HealthCacheDuration time.Duration `yaml:"healthCacheDuration" env:"HEALTH_CACHE_DURATION"`
+	// MetricsAddress is the listen address of the Prometheus /metrics endpoint, e.g. ":9090".
+	// It may equal HealthAddress. The endpoint is disabled if it is empty.
+	MetricsAddress string `yaml:"metricsAddress" env:"METRICS_ADDRESS"`
+	// AdmissionPolicy is the behavior of mutating requests while the Garage cluster lacks quorum
+	// or has staged layout changes: AdmissionStrict, AdmissionWarn or AdmissionOff.
+	AdmissionPolicy string `yaml:"admissionPolicy" env:"ADMISSION_POLICY"`
+	// TracingExporter is the OpenTelemetry trace exporter: TracingExporterNone,
+	// TracingExporterOTLP, TracingExporterStdout or TracingExporterFile.
+	TracingExporter string `yaml:"tracingExporter" env:"TRACING_EXPORTER"`
+	// TracingFile is the output file of TracingExporterFile.
+	TracingFile string `yaml:"tracingFile" env:"TRACING_FILE"`
+	// BucketMetricsInterval is the poll interval of bucket usage metrics, which are disabled if it is 0.
+	// Buckets are matched by the constant beginning of BucketAliasTemplate, which must not be empty.
+	BucketMetricsInterval time.Duration `yaml:"bucketMetricsInterval" env:"BUCKET_METRICS_INTERVAL"`
+	// BucketMetricsConcurrency limits the concurrent admin API calls while polling bucket usage.
+	BucketMetricsConcurrency int `yaml:"bucketMetricsConcurrency" env:"BUCKET_METRICS_CONCURRENCY"`
+	// ClusterMetricsInterval is the poll interval of Garage cluster health and layout metrics,
+	// which are disabled if it is 0.
+	ClusterMetricsInterval time.Duration `yaml:"clusterMetricsInterval" env:"CLUSTER_METRICS_INTERVAL"`
+	Garage                 *Garage       `yaml:"garage"`
+}
+
+// Permissions of an access key on a bucket.
+type Permissions struct {
+	Owner bool `yaml:"owner"`
+	Read  bool `yaml:"read"`
+	Write bool `yaml:"write"`
+}
+
+// BuiltinPermissionProfiles are the permission profiles available without configuration.
+var BuiltinPermissionProfiles = map[string]Permissions{
+	"readonly":  {Read: true},
+	"readwrite": {Read: true, Write: true},
+	"writeonly": {Write: true},
+	"owner":     {Owner: true, Read: true, Write: true},
 }
 
 // Garage settings.
 type Garage struct {
-	Endpoint           string
-	Region             string
-	AdminEndpoint      string
-	AdminToken         string
-	InsecureSkipVerify bool
+	Endpoint      string `yaml:"endpoint" env:"GARAGE_ENDPOINT"`
+	Region        string `yaml:"region" env:"GARAGE_REGION"`
+	AdminEndpoint string `yaml:"adminEndpoint" env:"GARAGE_ADMIN_ENDPOINT"`
+	AdminToken    string `yaml:"adminToken" env:"GARAGE_ADMIN_TOKEN" secret:"true"`
+	// AdminTokenFile is read instead of AdminToken and reloaded when it changes.
+	AdminTokenFile     string `yaml:"adminTokenFile" env:"GARAGE_ADMIN_TOKEN_FILE"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify" env:"GARAGE_INSECURE_SKIP_VERIFY"`
+	// CAFile, ClientCertFile and ClientKeyFile configure TLS with a custom CA
+	// and client certificates. Files are reloaded when they change.
+	CAFile         string `yaml:"caFile" env:"GARAGE_CA_FILE"`
+	ClientCertFile string `yaml:"clientCertFile" env:"GARAGE_CLIENT_CERT_FILE"`
+	ClientKeyFile  string `yaml:"clientKeyFile" env:"GARAGE_CLIENT_KEY_FILE"`
+	// TLSServerName overrides the server name used for certificate verification.
+	TLSServerName string `yaml:"tlsServerName" env:"GARAGE_TLS_SERVER_NAME"`
+	// TLSMinVersion is the minimum TLS version, e.g. "1.2".
+	TLSMinVersion string `yaml:"tlsMinVersion" env:"GARAGE_TLS_MIN_VERSION"`
+	// WebEndpoint is the public endpoint of the Garage web server,
+	// e.g. "https://web.garage.example.com". Optional.
+	WebEndpoint string `yaml:"webEndpoint" env:"GARAGE_WEB_ENDPOINT"`
+	// RetryMaxAttempts is the maximum number of attempts for admin API calls.
+	RetryMaxAttempts int `yaml:"retryMaxAttempts" env:"GARAGE_RETRY_MAX_ATTEMPTS"`
+	// RetryInitialBackoff and RetryMaxBackoff bound the wait time between attempts.
+	RetryInitialBackoff time.Duration `yaml:"retryInitialBackoff" env:"GARAGE_RETRY_INITIAL_BACKOFF"`
+	RetryMaxBackoff     time.Duration `yaml:"retryMaxBackoff" env:"GARAGE_RETRY_MAX_BACKOFF"`
+	// Timeouts of the admin API HTTP client. RequestTimeout bounds a request including retries.
+	ConnectTimeout        time.Duration `yaml:"connectTimeout" env:"GARAGE_CONNECT_TIMEOUT"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tlsHandshakeTimeout" env:"GARAGE_TLS_HANDSHAKE_TIMEOUT"`
+	ResponseHeaderTimeout time.Duration `yaml:"responseHeaderTimeout" env:"GARAGE_RESPONSE_HEADER_TIMEOUT"`
+	RequestTimeout        time.Duration `yaml:"requestTimeout" env:"GARAGE_REQUEST_TIMEOUT"`
+	// Connection pooling of the admin API HTTP client.
+	MaxIdleConnsPerHost int           `yaml:"maxIdleConnsPerHost" env:"GARAGE_MAX_IDLE_CONNS_PER_HOST"`
+	KeepAlive           time.Duration `yaml:"keepAlive" env:"GARAGE_KEEP_ALIVE"`
+	IdleConnTimeout     time.Duration `yaml:"idleConnTimeout" env:"GARAGE_IDLE_CONN_TIMEOUT"`
+}
+
+// RetryPolicy returns the retry policy for Garage admin API calls.
+func (g *Garage) RetryPolicy() retry.Policy {
+	return retry.Policy{
+		MaxAttempts:    g.RetryMaxAttempts,
+		InitialBackoff: g.RetryInitialBackoff,
+		MaxBackoff:     g.RetryMaxBackoff,
+	}
 }
 
-// Validate validates a configuration.
+// Default returns the default configuration.
+func Default() *Config {
+	return &Config{
+		COSIEndpoint:             "unix:///var/lib/cosi/cosi.sock",
+		DriverName:               "garage.objectstorage.k8s.io",
+		KeyNameTemplate:          "{{.AccountName}}",
+		BucketAliasTemplate:      "{{.Name}}",
+		RPCTimeout:               60 * time.Second,
+		StartupCheck:             StartupCheckExit,
+		StartupRetryInterval:     10 * time.Second,
+		HealthCacheDuration:      5 * time.Second,
+		AdmissionPolicy:          AdmissionOff,
+		TracingExporter:          TracingExporterNone,
+		BucketMetricsConcurrency: 4,
+		Garage: &Garage{
+			TLSMinVersion:         "1.2",
+			RetryMaxAttempts:      4,
+			RetryInitialBackoff:   200 * time.Millisecond,
+			RetryMaxBackoff:       5 * time.Second,
+			ConnectTimeout:        5 * time.Second,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: 10 * time.Second,
+			RequestTimeout:        30 * time.Second,
+			MaxIdleConnsPerHost:   16,
+			KeepAlive:             30 * time.Second,
+			IdleConnTimeout:       90 * time.Second,
+		},
+	}
+}
+
+// Validate validates a configuration and returns all errors, prefixed with the field path.
 func (c *Config) Validate() error {
+	var errs []error
+
+	invalid := func(path, msg string) {
+		errs = append(errs, fmt.Errorf("%s: %s", path, msg))
+	}
+
 	if c.DriverName == "" {
-		return errors.New("driver name cannot cannot be empty")
+		invalid("driverName", "cannot be empty")
+	}
+
+	if c.KeyNameTemplate == "" {
+		invalid("keyNameTemplate", "cannot be empty")
+	} else if _, err := naming.NewKeyNameTemplate(c.KeyNameTemplate); err != nil {
+		invalid("keyNameTemplate", err.Error())
+	}
+
+	if c.BucketAliasTemplate == "" {
+		invalid("bucketAliasTemplate", "cannot be empty")
+	} else if aliases, err := naming.NewBucketAliasTemplate(c.BucketAliasTemplate, c.ClusterName, c.DriverName); err != nil {
+		invalid("bucketAliasTemplate", err.Error())
+	} else if c.BucketMetricsInterval > 0 {
+		// Managed buckets are told apart from other buckets by the alias prefix.
+		prefix, err := aliases.Prefix()
+		if err != nil {
+			invalid("bucketAliasTemplate", err.Error())
+		} else if prefix == "" {
+			invalid("bucketMetricsInterval", `requires a bucketAliasTemplate with a constant prefix before .Name, e.g. "cosi-{{.Name}}"`)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.PermissionProfiles)) {
+		if _, ok := BuiltinPermissionProfiles[name]; ok {
+			invalid("permissionProfiles."+name, "cannot override a built-in profile")
+		}
 	}
 
 	if c.COSIEndpoint == "" {
-		return errors.New("COSI endpoint cannot be empty")
+		invalid("cosiEndpoint", "cannot be empty")
+	}
+
+	if c.RPCTimeout < 0 {
+		invalid("rpcTimeout", "cannot be negative")
+	}
+
+	if c.HealthCacheDuration < 0 {
+		invalid("healthCacheDuration", "cannot be negative")
+	}
+
+	if c.BucketMetricsInterval < 0 {
+		invalid("bucketMetricsInterval", "cannot be negative")
+	}
+
+	if c.BucketMetricsInterval > 0 && c.MetricsAddress == "" {
+		invalid("bucketMetricsInterval", "requires metricsAddress to be set")
+	}
+
+	if c.ClusterMetricsInterval < 0 {
+		invalid("clusterMetricsInterval", "cannot be negative")
+	}
+
+	if c.ClusterMetricsInterval > 0 && c.MetricsAddress == "" {
+		invalid("clusterMetricsInterval", "requires metricsAddress to be set")
+	}
+
+	if c.BucketMetricsConcurrency < 1 {
+		invalid("bucketMetricsConcurrency", "must be at least 1")
+	}
+
+	switch c.AdmissionPolicy {
+	case AdmissionStrict, AdmissionWarn, AdmissionOff:
+	default:
+		invalid("admissionPolicy", fmt.Sprintf("must be %q, %q or %q", AdmissionStrict, AdmissionWarn, AdmissionOff))
+	}
+
+	switch c.TracingExporter {
+	case TracingExporterNone, TracingExporterOTLP, TracingExporterStdout:
+	case TracingExporterFile:
+		if c.TracingFile == "" {
+			invalid("tracingFile", "cannot be empty with the file exporter")
+		}
+	default:
+		invalid("tracingExporter", fmt.Sprintf("must be %q, %q, %q or %q", TracingExporterNone, TracingExporterOTLP, TracingExporterStdout, TracingExporterFile))
+	}
+
+	switch c.StartupCheck {
+	case StartupCheckExit:
+	case StartupCheckRetry:
+		if c.StartupRetryInterval <= 0 {
+			invalid("startupRetryInterval", "must be positive")
+		}
+	default:
+		invalid("startupCheck", fmt.Sprintf("must be %q or %q", StartupCheckExit, StartupCheckRetry))
 	}
 
 	if c.Garage == nil {
-		return errors.New("Garage settings cannot be nil")
+		invalid("garage", "cannot be empty")
+		return errors.Join(errs...)
 	}
 
-	if c.Garage.Endpoint == "" {
-		return errors.New("Garage endpoint cannot be empty")
+	if err := validURL(c.Garage.Endpoint); err != nil {
+		invalid("garage.endpoint", err.Error())
 	}
 
 	if c.Garage.Region == "" {
-		return errors.New("Garage region cannot be empty")
+		invalid("garage.region", "cannot be empty")
+	}
+
+	if err := validURL(c.Garage.AdminEndpoint); err != nil {
+		invalid("garage.adminEndpoint", err.Error())
+	}
+
+	if c.Garage.AdminToken == "" && c.Garage.AdminTokenFile == "" {
+		invalid("garage.adminToken", "admin token or admin token file must be set")
+	}
+
+	if c.Garage.AdminToken != "" && c.Garage.AdminTokenFile != "" {
+		invalid("garage.adminTokenFile", "mutually exclusive with admin token")
+	}
+
+	if (c.Garage.ClientCertFile == "") != (c.Garage.ClientKeyFile == "") {
+		invalid("garage.clientKeyFile", "client certificate and key files must be set together")
+	}
+
+	if _, err := tlsconfig.ParseVersion(c.Garage.TLSMinVersion); err != nil {
+		invalid("garage.tlsMinVersion", err.Error())
+	}
+
+	if c.Garage.RetryMaxAttempts < 1 {
+		invalid("garage.retryMaxAttempts", "must be at least 1")
+	}
+
+	if c.Garage.RetryInitialBackoff < 0 {
+		invalid("garage.retryInitialBackoff", "cannot be negative")
+	}
+
+	if c.Garage.RetryMaxBackoff < c.Garage.RetryInitialBackoff {
+		invalid("garage.retryMaxBackoff", "cannot be below the initial backoff")
+	}
+
+	for _, d := range []struct {
+		path  string
+		value time.Duration
+	}{
+		{"garage.connectTimeout", c.Garage.ConnectTimeout},
+		{"garage.tlsHandshakeTimeout", c.Garage.TLSHandshakeTimeout},
+		{"garage.responseHeaderTimeout", c.Garage.ResponseHeaderTimeout},
+		{"garage.requestTimeout", c.Garage.RequestTimeout},
+		{"garage.keepAlive", c.Garage.KeepAlive},
+		{"garage.idleConnTimeout", c.Garage.IdleConnTimeout},
+	} {
+		if d.value < 0 {
+			invalid(d.path, "cannot be negative")
+		}
+	}
+
+	if c.Garage.MaxIdleConnsPerHost < 0 {
+		invalid("garage.maxIdleConnsPerHost", "cannot be negative")
+	}
+
+	if c.Garage.WebEndpoint != "" {
+		if err := validURL(c.Garage.WebEndpoint); err != nil {
+			invalid("garage.webEndpoint", err.Error())
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validURL checks that s is an absolute HTTP or HTTPS URL with a host.
+func validURL(s string) error {
+	if s == "" {
+		return errors.New("cannot be empty")
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return fmt.Errorf("must be a valid URL: %w", err)
 	}
 
-	if c.Garage.AdminEndpoint == "" {
-		return errors.New("Garage admin endpoint cannot be empty")
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("must be an http or https URL, got %q", s)
 	}
 
-	if c.Garage.AdminToken == "" {
-		return errors.New("Garage admin token cannot be empty")
+	if u.Host == "" {
+		return fmt.Errorf("must be a URL with a host, got %q", s)
 	}
 
 	return nil
 }
+
+// ParsePermissionProfiles parses permission profiles in the format
+// "name=permission+permission;name=permission", e.g. "uploader=read+write;auditor=read".
+func ParsePermissionProfiles(s string) (map[string]Permissions, error) {
+	profiles := map[string]Permissions{}
+
+	for _, def := range strings.Split(s, ";") {
+		if strings.TrimSpace(def) == "" {
+			continue
+		}
+
+		name, perms, ok := strings.Cut(def, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid permission profile %q", def)
+		}
+
+		if _, ok := profiles[name]; ok {
+			return nil, fmt.Errorf("duplicate permission profile %q", name)
+		}
+
+		var p Permissions
+		for _, perm := range strings.Split(perms, "+") {
+			switch strings.TrimSpace(perm) {
+			case "owner":
+				p.Owner = true
+			case "read":
+				p.Read = true
+			case "write":
+				p.Write = true
+			case "":
+			default:
+				return nil, fmt.Errorf("invalid permission %q in profile %q", perm, name)
+			}
+		}
+
+		profiles[name] = p
+	}
+
+	return profiles, nil
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig returns the default configuration with the required settings.
+func validConfig() *Config {
+	c := Default()
+	c.Garage.Endpoint = "https://s3.garage.example.com"
+	c.Garage.Region = "garage"
+	c.Garage.AdminEndpoint = "https://admin.garage.example.com"
+	c.Garage.AdminToken = "token"
+
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr []string
+	}{
+		{
+			name:   "valid",
+			modify: func(*Config) {},
+		},
+		{
+			name: "templates",
+			modify: func(c *Config) {
+				c.KeyNameTemplate = "cosi-{{.BucketID}}"
+				c.BucketAliasTemplate = "{{.Name"
+			},
+			wantErr: []string{
+				"keyNameTemplate: key name must depend on .AccountName",
+				"bucketAliasTemplate: template: bucketAlias:1: unclosed action",
+			},
+		},
+		{
+			name: "built-in permission profile",
+			modify: func(c *Config) {
+				c.PermissionProfiles = map[string]Permissions{
+					"readonly": {Read: true},
+					"uploader": {Read: true, Write: true},
+				}
+			},
+			wantErr: []string{"permissionProfiles.readonly: cannot override a built-in profile"},
+		},
+		{
+			name: "bucket metrics without alias prefix",
+			modify: func(c *Config) {
+				c.MetricsAddress = ":9090"
+				c.BucketMetricsInterval = time.Minute
+			},
+			wantErr: []string{"bucketMetricsInterval: requires a bucketAliasTemplate with a constant prefix"},
+		},
+		{
+			name: "bucket metrics with alias prefix",
+			modify: func(c *Config) {
+				c.MetricsAddress = ":9090"
+				c.BucketMetricsInterval = time.Minute
+				c.BucketAliasTemplate = "cosi-{{.Name}}"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.modify(c)
+
+			err := c.Validate()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("got error %v, want none", err)
+				}
+
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("got no error, want %q", tt.wantErr)
+			}
+
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(tt.wantErr) {
+				t.Fatalf("got errors %q, want %q", lines, tt.wantErr)
+			}
+
+			for i, want := range tt.wantErr {
+				if !strings.HasPrefix(lines[i], want) {
+					t.Errorf("got error %q, want %q", lines[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secrets in the printed configuration.
+const redacted = "<redacted>"
+
+// field describes a configuration option.
+type field struct {
+	// path is the dot-separated path of YAML keys, e.g. "garage.adminEndpoint".
+	path   string
+	env    string
+	flag   string
+	secret bool
+	index  []int
+}
+
+// fields returns the configuration options of a struct type. Nested structs are flattened.
+func fields(t reflect.Type, path []string, index []int) []field {
+	var out []field
+
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		p := append(slices.Clone(path), name)
+		idx := append(slices.Clone(index), i)
+
+		if sf.Type.Kind() == reflect.Pointer && sf.Type.Elem().Kind() == reflect.Struct {
+			out = append(out, fields(sf.Type.Elem(), p, idx)...)
+			continue
+		}
+
+		out = append(out, field{
+			path:   strings.Join(p, "."),
+			env:    sf.Tag.Get("env"),
+			flag:   flagName(p),
+			secret: sf.Tag.Get("secret") == "true",
+			index:  idx,
+		})
+	}
+
+	return out
+}
+
+// flagName converts a path of YAML keys to a flag name, e.g. "garage-admin-endpoint".
+func flagName(path []string) string {
+	var b strings.Builder
+
+	for i, name := range path {
+		if i > 0 {
+			b.WriteByte('-')
+		}
+
+		for j, r := range name {
+			if unicode.IsUpper(r) {
+				if j > 0 {
+					b.WriteByte('-')
+				}
+
+				r = unicode.ToLower(r)
+			}
+
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// Load returns the configuration from defaults, a configuration file, environment
+// variables and command-line flags, in increasing order of precedence.
+// The flags, including --config for the path to a YAML or JSON file, are registered on fs
+// and parsed from args. Invalid values are reported together.
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg := Default()
+	opts := fields(reflect.TypeFor[Config](), nil, nil)
+
+	file := fs.String("config", "", "Path to a YAML or JSON configuration file.")
+
+	flags := map[string]string{}
+	for _, o := range opts {
+		usage := fmt.Sprintf("Sets %s.", o.path)
+		if o.env != "" {
+			usage = fmt.Sprintf("Sets %s, overrides $%s.", o.path, o.env)
+		}
+
+		fs.Func(o.flag, usage, func(v string) error {
+			flags[o.path] = v
+			return nil
+		})
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *file != "" {
+		if err := cfg.loadFile(*file); err != nil {
+			return nil, err
+		}
+	}
+
+	v := reflect.ValueOf(cfg).Elem()
+
+	var errs []error
+	for _, o := range opts {
+		if s, ok := os.LookupEnv(o.env); ok && o.env != "" {
+			if err := set(v.FieldByIndex(o.index), s); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid value of $%s: %w", o.path, o.env, err))
+			}
+		}
+
+		if s, ok := flags[o.path]; ok {
+			if err := set(v.FieldByIndex(o.index), s); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid value of --%s: %w", o.path, o.flag, err))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return cfg, nil
+}
+
+// loadFile reads a YAML or JSON configuration file over the current configuration.
+// Unknown keys are rejected.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	// Keep defaults if the Garage section is explicitly set to null.
+	if c.Garage == nil {
+		c.Garage = Default().Garage
+	}
+
+	return nil
+}
+
+// set parses s into a configuration option.
+func set(v reflect.Value, s string) error {
+	switch v.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(int64(d))
+	case map[string]Permissions:
+		p, err := ParsePermissionProfiles(s)
+		if err != nil {
+			return err
+		}
+
+		v.Set(reflect.ValueOf(p))
+	case string:
+		v.SetString(s)
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+
+		v.SetBool(b)
+	case int:
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(int64(i))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// Print writes the configuration as YAML with secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	n, err := encode(reflect.ValueOf(c).Elem())
+	if err != nil {
+		return err
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2) //nolint:mnd // YAML indentation.
+
+	if err := enc.Encode(n); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+// encode returns a YAML mapping of a configuration struct in field order.
+// Durations are written in their string form and secrets are redacted.
+func encode(v reflect.Value) (*yaml.Node, error) {
+	n := &yaml.Node{Kind: yaml.MappingNode}
+
+	for i := range v.NumField() {
+		sf := v.Type().Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		fv := v.Field(i)
+
+		var value any = fv.Interface()
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+
+		if sf.Tag.Get("secret") == "true" && !fv.IsZero() {
+			value = redacted
+		}
+
+		var vn *yaml.Node
+		if fv.Kind() == reflect.Pointer && fv.Type().Elem().Kind() == reflect.Struct && !fv.IsNil() {
+			var err error
+			if vn, err = encode(fv.Elem()); err != nil {
+				return nil, err
+			}
+		} else {
+			vn = &yaml.Node{}
+			if err := vn.Encode(value); err != nil {
+				return nil, fmt.Errorf("error encoding %s: %w", name, err)
+			}
+		}
+
+		n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, vn)
+	}
+
+	return n, nil
+}
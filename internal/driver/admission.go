@@ -0,0 +1,128 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/mpreu/cosi-driver-garage/internal/client"
+	"github.com/mpreu/cosi-driver-garage/internal/config"
+	"github.com/mpreu/cosi-driver-garage/internal/health"
+)
+
+// admission checks the Garage cluster state before mutating requests, since changes
+// while partitions lack quorum or layout changes are pending can fail partially.
+// The cluster health is shared with the readiness checks, the layout is cached here.
+type admission struct {
+	health *health.Cache
+	client client.ClientWithResponsesInterface
+	policy string
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	checked time.Time
+	staged  int
+	err     error
+}
+
+// newAdmission returns an admission check with the given policy, using the cached
+// cluster health and caching the cluster layout for ttl.
+func newAdmission(h *health.Cache, c client.ClientWithResponsesInterface, policy string, ttl time.Duration) *admission {
+	return &admission{
+		health: h,
+		client: c,
+		policy: policy,
+		ttl:    ttl,
+	}
+}
+
+// admit returns an Unavailable error with the reason if the cluster cannot serve mutating
+// requests and the policy is strict. With the warn policy, the reason is only logged.
+func (a *admission) admit(ctx context.Context, logger *slog.Logger) error {
+	if a.policy == config.AdmissionOff {
+		return nil
+	}
+
+	reason, err := a.check(ctx)
+	if err != nil {
+		reason = fmt.Sprintf("cannot check Garage cluster state: %s", err)
+	}
+
+	if reason == "" {
+		return nil
+	}
+
+	if a.policy == config.AdmissionWarn {
+		logger.Warn("Admitting request despite Garage cluster state", "reason", reason)
+		return nil
+	}
+
+	logger.Error("Refusing request because of Garage cluster state", "reason", reason)
+
+	return status.Error(codes.Unavailable, reason)
+}
+
+// check returns why the cluster cannot serve mutating requests or an empty reason.
+func (a *admission) check(ctx context.Context) (string, error) {
+	h, err := a.health.Get(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if h.Status == health.StatusUnavailable || h.PartitionsQuorum < h.Partitions {
+		return fmt.Sprintf("Garage cluster has lost quorum: %d of %d partitions have quorum",
+			h.PartitionsQuorum, h.Partitions), nil
+	}
+
+	staged, err := a.stagedRoleChanges(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if staged > 0 {
+		return fmt.Sprintf("Garage cluster layout has %d staged role changes, which are not applied", staged), nil
+	}
+
+	return "", nil
+}
+
+// stagedRoleChanges returns the number of staged role changes of the cluster layout.
+// The result is cached, unless the query was canceled.
+func (a *admission) stagedRoleChanges(ctx context.Context) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.checked.IsZero() && time.Since(a.checked) < a.ttl {
+		return a.staged, a.err
+	}
+
+	staged, err := a.queryLayout(ctx)
+	if ctx.Err() != nil {
+		return staged, err
+	}
+
+	a.checked = time.Now()
+	a.staged, a.err = staged, err
+
+	return staged, err
+}
+
+// queryLayout gets the number of staged role changes from the Garage admin API.
+func (a *admission) queryLayout(ctx context.Context) (int, error) {
+	resp, err := a.client.GetLayoutWithResponse(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode() != http.StatusOK || resp.JSON200 == nil {
+		return 0, fmt.Errorf("error getting cluster layout: %w", newAPIError(resp.StatusCode(), resp.Body))
+	}
+
+	return len(resp.JSON200.StagedRoleChanges), nil
+}
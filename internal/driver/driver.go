@@ -1,26 +1,71 @@
 package driver
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 
 	cosi "sigs.k8s.io/container-object-storage-interface-spec"
 
 	"github.com/mpreu/cosi-driver-garage/internal/client"
 	"github.com/mpreu/cosi-driver-garage/internal/config"
+	"github.com/mpreu/cosi-driver-garage/internal/health"
+	"github.com/mpreu/cosi-driver-garage/internal/naming"
 )
 
 // New returns implementations for the COSI.IdentityServer and
 // cosi.ProvisionerServer interfaces.
-func New(driverName string, config *config.Garage, c client.ClientWithResponsesInterface, logger *slog.Logger) (cosi.IdentityServer, cosi.ProvisionerServer) {
+func New(ctx context.Context, config *config.Config, c client.ClientWithResponsesInterface, h *health.Cache, logger *slog.Logger) (cosi.IdentityServer, cosi.ProvisionerServer, error) {
 	is := &identityServer{
-		driverName: driverName,
+		driverName: config.DriverName,
 	}
 
 	ps := &provisionerServer{
-		client: c,
-		config: config,
-		logger: logger,
+		client:     c,
+		config:     config.Garage,
+		driverName: config.DriverName,
+		logger:     logger,
+		names:      newKeyedMutex(),
+		accounts:   newKeyedMutex(),
+		retry:      config.Garage.RetryPolicy(),
+		admission:  newAdmission(h, c, config.AdmissionPolicy, config.HealthCacheDuration),
+
+		allowCreateBucket: config.AllowCreateBucket,
+	}
+
+	ps.profiles = permissionProfiles(config.PermissionProfiles)
+
+	keyName, err := naming.NewKeyNameTemplate(config.KeyNameTemplate)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid key name template: %w", err)
+	}
+
+	ps.keyName = keyName
+
+	bucketAlias, err := naming.NewBucketAliasTemplate(config.BucketAliasTemplate, config.ClusterName, config.DriverName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid bucket alias template: %w", err)
+	}
+
+	ps.bucketAlias = bucketAlias
+
+	if config.BucketIndex {
+		ps.index = newBucketIndex()
+		if err := ps.index.load(ctx, c); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return is, ps, nil
+}
+
+// BucketAliasPrefix returns the beginning shared by the global aliases of all buckets
+// created by the driver, according to the bucket alias template.
+func BucketAliasPrefix(config *config.Config) (string, error) {
+	t, err := naming.NewBucketAliasTemplate(config.BucketAliasTemplate, config.ClusterName, config.DriverName)
+	if err != nil {
+		return "", err
 	}
 
-	return is, ps
+	return t.Prefix()
 }
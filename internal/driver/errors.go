@@ -0,0 +1,110 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain is the domain of gRPC error details for Garage admin API errors.
+const errorDomain = "garagehq.deuxfleurs.fr"
+
+// apiError is an error response of the Garage admin API.
+type apiError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+// newAPIError parses an error response of the Garage admin API.
+// The body is optional, since not every response contains a JSON error.
+func newAPIError(statusCode int, body []byte) *apiError {
+	e := &apiError{}
+	_ = json.Unmarshal(body, e)
+	e.StatusCode = statusCode
+
+	return e
+}
+
+// Error implements error.
+func (e *apiError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("HTTP status code %d", e.StatusCode)
+	}
+
+	return fmt.Sprintf("HTTP status code %d, %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// grpcCode maps the HTTP status code of the error to a gRPC status code.
+func (e *apiError) grpcCode() codes.Code {
+	switch {
+	case e.StatusCode == http.StatusBadRequest:
+		return codes.InvalidArgument
+	case e.StatusCode == http.StatusUnauthorized, e.StatusCode == http.StatusForbidden:
+		return codes.PermissionDenied
+	case e.StatusCode == http.StatusNotFound:
+		return codes.NotFound
+	case e.StatusCode == http.StatusConflict:
+		return codes.AlreadyExists
+	case e.StatusCode >= http.StatusInternalServerError:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+// statusError translates an error of a Garage admin API call into a gRPC status error.
+// Garage error responses carry their error code as google.rpc.ErrorInfo detail.
+func statusError(err error, msg string) error {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		reason := apiErr.Code
+		if reason == "" {
+			reason = http.StatusText(apiErr.StatusCode)
+		}
+
+		if apiErr.Message != "" {
+			msg = msg + ": " + apiErr.Message
+		}
+
+		st, detailErr := status.New(apiErr.grpcCode(), msg).WithDetails(&errdetails.ErrorInfo{
+			Reason: reason,
+			Domain: errorDomain,
+			Metadata: map[string]string{
+				"httpStatusCode": strconv.Itoa(apiErr.StatusCode),
+			},
+		})
+		if detailErr != nil {
+			return status.Error(apiErr.grpcCode(), msg)
+		}
+
+		return st.Err()
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	var urlErr *url.Error
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, msg)
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, msg)
+	case errors.As(err, &urlErr), errors.As(err, &netErr):
+		return status.Error(codes.Unavailable, msg)
+	default:
+		return status.Error(codes.Internal, msg)
+	}
+}
@@ -0,0 +1,85 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/mpreu/cosi-driver-garage/internal/client"
+)
+
+// bucketIndex is an in-memory index of Garage bucket global aliases to bucket IDs.
+// It avoids admin API lookups for buckets that do not exist yet.
+type bucketIndex struct {
+	mu      sync.RWMutex
+	ids     map[string]string
+	aliases map[string][]string
+}
+
+// newBucketIndex returns an empty bucket index.
+func newBucketIndex() *bucketIndex {
+	return &bucketIndex{
+		ids:     map[string]string{},
+		aliases: map[string][]string{},
+	}
+}
+
+// load fills the index with all buckets known to Garage.
+func (i *bucketIndex) load(ctx context.Context, c client.ClientWithResponsesInterface) error {
+	list, err := c.ListBucketsWithResponse(ctx)
+	if err != nil {
+		return err
+	}
+
+	if list.StatusCode() != http.StatusOK {
+		return fmt.Errorf("error listing buckets: %w", newAPIError(list.StatusCode(), list.Body))
+	}
+
+	for _, l := range *list.JSON200 {
+		if l.GlobalAliases == nil {
+			continue
+		}
+
+		for _, alias := range *l.GlobalAliases {
+			i.set(alias, l.Id)
+		}
+	}
+
+	return nil
+}
+
+// get returns the bucket ID for a global alias.
+func (i *bucketIndex) get(alias string) (string, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	id, ok := i.ids[alias]
+	return id, ok
+}
+
+// set adds a global alias of a bucket to the index.
+func (i *bucketIndex) set(alias, id string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.ids[alias] = id
+	if !slices.Contains(i.aliases[id], alias) {
+		i.aliases[id] = append(i.aliases[id], alias)
+	}
+}
+
+// delete removes a bucket and all its global aliases from the index.
+func (i *bucketIndex) delete(id string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, alias := range i.aliases[id] {
+		if i.ids[alias] == id {
+			delete(i.ids, alias)
+		}
+	}
+
+	delete(i.aliases, id)
+}
@@ -0,0 +1,35 @@
+package driver
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBucketIndex(t *testing.T) {
+	i := newBucketIndex()
+
+	i.set("a", "1")
+	i.set("b", "1")
+	i.set("a", "1")
+	i.set("c", "2")
+
+	if got, want := i.aliases["1"], []string{"a", "b"}; !slices.Equal(got, want) {
+		t.Errorf("got aliases %q, want %q", got, want)
+	}
+
+	if id, ok := i.get("a"); !ok || id != "1" {
+		t.Errorf("got ID %q, %t for alias a, want 1", id, ok)
+	}
+
+	i.delete("1")
+
+	for _, alias := range []string{"a", "b"} {
+		if id, ok := i.get(alias); ok {
+			t.Errorf("got ID %q for alias %s after delete, want none", id, alias)
+		}
+	}
+
+	if id, ok := i.get("c"); !ok || id != "2" {
+		t.Errorf("got ID %q, %t for alias c, want 2", id, ok)
+	}
+}
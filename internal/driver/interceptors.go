@@ -0,0 +1,46 @@
+package driver
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/mpreu/cosi-driver-garage/internal/metrics"
+)
+
+// DeadlineInterceptor returns a gRPC server interceptor applying a default
+// deadline to requests whose context has none.
+func DeadlineInterceptor(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if _, ok := ctx.Deadline(); !ok && timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// MetricsInterceptor returns a gRPC server interceptor recording the number,
+// latency and status code of requests.
+func MetricsInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		method := path.Base(info.FullMethod)
+
+		metrics.RPCInFlight.WithLabelValues(method).Inc()
+		defer metrics.RPCInFlight.WithLabelValues(method).Dec()
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err).String()
+		metrics.RPCRequests.WithLabelValues(method, code).Inc()
+		metrics.RPCDuration.WithLabelValues(method, code).Observe(time.Since(start).Seconds())
+
+		return resp, err
+	}
+}
@@ -0,0 +1,48 @@
+package driver
+
+import "sync"
+
+// keyedMutex serializes operations on the same key, while operations
+// on different keys run concurrently.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+// keyedLock is a reference counted lock for a single key.
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// newKeyedMutex returns an empty keyed mutex.
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{
+		locks: map[string]*keyedLock{},
+	}
+}
+
+// lock acquires the lock for a key and returns a function to release it.
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.mu.Lock()
+
+	return func() {
+		l.mu.Unlock()
+
+		k.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
@@ -0,0 +1,223 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mpreu/cosi-driver-garage/internal/client"
+)
+
+// defaultIndexDocument is the index document of buckets with website access.
+const defaultIndexDocument = "index.html"
+
+// bucketParameters represents supported BucketClass parameters.
+type bucketParameters struct {
+	maxSize       *int64
+	maxObjects    *int64
+	website       bool
+	indexDocument string
+	errorDocument string
+
+	existingBucketID    string
+	existingBucketAlias string
+}
+
+// adopt returns true if an existing bucket should be adopted instead of creating a new one.
+func (b *bucketParameters) adopt() bool {
+	return b.existingBucketID != "" || b.existingBucketAlias != ""
+}
+
+// hasQuotas returns true if any bucket quota is configured.
+func (b *bucketParameters) hasQuotas() bool {
+	return b.maxSize != nil || b.maxObjects != nil
+}
+
+// bucketClassParameters parses the bucket parameters from BucketClass parameters.
+// No quotas are configured and website access is disabled by default.
+func bucketClassParameters(params map[string]string) (*bucketParameters, error) {
+	b := &bucketParameters{
+		indexDocument: defaultIndexDocument,
+	}
+
+	if params == nil {
+		return b, nil
+	}
+
+	if v, ok := params["maxSize"]; ok {
+		q, err := parseQuantity(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maxSize: %w", err)
+		}
+
+		b.maxSize = &q
+	}
+
+	if v, ok := params["maxObjects"]; ok {
+		q, err := parseQuantity(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maxObjects: %w", err)
+		}
+
+		b.maxObjects = &q
+	}
+
+	if v, ok := params["website"]; ok {
+		w, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid website: %w", err)
+		}
+
+		b.website = w
+	}
+
+	if v, ok := params["indexDocument"]; ok {
+		if !b.website {
+			return nil, errors.New("indexDocument requires website to be enabled")
+		}
+
+		if v == "" {
+			return nil, errors.New("indexDocument cannot be empty")
+		}
+
+		b.indexDocument = v
+	}
+
+	if v, ok := params["errorDocument"]; ok {
+		if !b.website {
+			return nil, errors.New("errorDocument requires website to be enabled")
+		}
+
+		b.errorDocument = v
+	}
+
+	b.existingBucketID = params["existingBucketId"]
+	b.existingBucketAlias = params["existingBucketAlias"]
+
+	if b.existingBucketID != "" && b.existingBucketAlias != "" {
+		return nil, errors.New("existingBucketId and existingBucketAlias are mutually exclusive")
+	}
+
+	// Settings of adopted buckets are owned outside of COSI and not changed by the driver.
+	if b.adopt() && (b.hasQuotas() || b.website) {
+		return nil, errors.New("existing buckets cannot be combined with quota or website parameters")
+	}
+
+	return b, nil
+}
+
+// matches checks if an existing bucket with the given global alias is configured
+// according to the bucket parameters and returns an error describing the first mismatch.
+func (b *bucketParameters) matches(alias string, info *client.BucketInfo) error {
+	if info.GlobalAliases == nil || !slices.Contains(*info.GlobalAliases, alias) {
+		return fmt.Errorf("bucket has no global alias %q", alias)
+	}
+
+	var maxSize, maxObjects *int64
+	if info.Quotas != nil {
+		maxSize = info.Quotas.MaxSize
+		maxObjects = info.Quotas.MaxObjects
+	}
+
+	if !equalPtr(b.maxSize, maxSize) {
+		return errors.New("maxSize quota differs")
+	}
+
+	if !equalPtr(b.maxObjects, maxObjects) {
+		return errors.New("maxObjects quota differs")
+	}
+
+	website := info.WebsiteAccess != nil && *info.WebsiteAccess
+	if b.website != website {
+		return errors.New("website access differs")
+	}
+
+	if !website {
+		return nil
+	}
+
+	var indexDocument, errorDocument string
+	if info.WebsiteConfig != nil {
+		if info.WebsiteConfig.IndexDocument != nil {
+			indexDocument = *info.WebsiteConfig.IndexDocument
+		}
+
+		if info.WebsiteConfig.ErrorDocument != nil {
+			errorDocument = *info.WebsiteConfig.ErrorDocument
+		}
+	}
+
+	if b.indexDocument != indexDocument {
+		return errors.New("website index document differs")
+	}
+
+	if b.errorDocument != errorDocument {
+		return errors.New("website error document differs")
+	}
+
+	return nil
+}
+
+// equalPtr returns true if both pointers are nil or point to equal values.
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+// quantitySuffixes maps supported quantity suffixes to their multiplier.
+// Binary suffixes follow the Kubernetes resource quantity notation.
+var quantitySuffixes = map[string]int64{
+	"k":  1e3,
+	"K":  1e3,
+	"M":  1e6,
+	"G":  1e9,
+	"T":  1e12,
+	"P":  1e15,
+	"E":  1e18,
+	"Ki": 1 << 10,
+	"Mi": 1 << 20,
+	"Gi": 1 << 30,
+	"Ti": 1 << 40,
+	"Pi": 1 << 50,
+	"Ei": 1 << 60,
+}
+
+// parseQuantity parses a non-negative integer with an optional decimal (k, M, G, ...)
+// or binary (Ki, Mi, Gi, ...) suffix, e.g. "50Gi" or "100k".
+func parseQuantity(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+
+	number := strings.TrimRightFunc(s, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	suffix := s[len(number):]
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quantity %q", s)
+	}
+
+	if n < 0 {
+		return 0, fmt.Errorf("quantity %q cannot be negative", s)
+	}
+
+	if suffix == "" {
+		return n, nil
+	}
+
+	m, ok := quantitySuffixes[suffix]
+	if !ok {
+		return 0, fmt.Errorf("invalid quantity suffix %q", suffix)
+	}
+
+	if n > 0 && n > (1<<63-1)/m {
+		return 0, fmt.Errorf("quantity %q is too large", s)
+	}
+
+	return n * m, nil
+}
@@ -2,11 +2,13 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"slices"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -14,6 +16,9 @@ import (
 
 	"github.com/mpreu/cosi-driver-garage/internal/client"
 	"github.com/mpreu/cosi-driver-garage/internal/config"
+	"github.com/mpreu/cosi-driver-garage/internal/metrics"
+	"github.com/mpreu/cosi-driver-garage/internal/naming"
+	"github.com/mpreu/cosi-driver-garage/internal/retry"
 )
 
 // Interface assert.
@@ -22,9 +27,20 @@ var _ cosi.ProvisionerServer = &provisionerServer{}
 // provisionerServer implements cosi.ProvisionerServer.
 type provisionerServer struct {
 	cosi.UnimplementedProvisionerServer
-	client client.ClientWithResponsesInterface
-	config *config.Garage
-	logger *slog.Logger
+	client      client.ClientWithResponsesInterface
+	config      *config.Garage
+	driverName  string
+	logger      *slog.Logger
+	index       *bucketIndex
+	names       *keyedMutex
+	accounts    *keyedMutex
+	profiles    map[string]accessPermissions
+	keyName     *naming.KeyNameTemplate
+	retry       retry.Policy
+	bucketAlias *naming.BucketAliasTemplate
+	admission   *admission
+	// allowCreateBucket permits BucketAccessClasses to grant keys the permission to create buckets.
+	allowCreateBucket bool
 }
 
 // DriverCreateBucket implements cosi.ProvisionerServer.
@@ -38,23 +54,56 @@ func (p *provisionerServer) DriverCreateBucket(ctx context.Context, r *cosi.Driv
 	logger := p.logger.With("req", r)
 	logger.Info("DriverCreateBucket request")
 
-	name := r.GetName()
+	name, err := p.bucketAlias.Render(r.GetName())
+	if err != nil {
+		logger.Error("Failed to render bucket alias", "error", err)
+		return nil, status.Errorf(codes.InvalidArgument, "failed to render bucket alias: %s", err)
+	}
 
-	// Check if bucket already exists.
-	existingID, err := p.hasBucket(ctx, name)
+	params, err := bucketClassParameters(r.Parameters)
 	if err != nil {
-		logger.Error("Failed to check for existing bucket", "error", err)
-		return nil, status.Error(codes.Internal, "failed to check for existing bucket")
+		logger.Error("Failed to parse BucketClass parameters", "error", err)
+		return nil, status.Errorf(codes.InvalidArgument, "failed to parse BucketClass parameters: %s", err)
 	}
 
-	// Since no parameters apart from the name are accepted, return without error.
-	if existingID != nil {
+	// Bind to an existing bucket instead of creating a new one.
+	if params.adopt() {
+		info, err := p.findBucket(ctx, params.existingBucketID, params.existingBucketAlias)
+		if err != nil {
+			logger.Error("Failed to get existing bucket to adopt", "error", err)
+			return nil, statusError(err, "failed to get existing bucket to adopt")
+		}
+
+		if info == nil {
+			logger.Error("Existing bucket to adopt not found")
+			return nil, status.Error(codes.NotFound, "existing bucket to adopt not found")
+		}
+
 		return &cosi.DriverCreateBucketResponse{
-			BucketId:   *existingID,
+			BucketId:   adoptedBucketPrefix + *info.Id,
 			BucketInfo: p.protocol(),
 		}, nil
 	}
 
+	if err := p.admission.admit(ctx, logger); err != nil {
+		return nil, err
+	}
+
+	// Serialize concurrent requests for the same bucket name.
+	unlock := p.names.lock(name)
+	defer unlock()
+
+	// Check if bucket already exists.
+	existing, err := p.hasBucket(ctx, name)
+	if err != nil {
+		logger.Error("Failed to check for existing bucket", "error", err)
+		return nil, statusError(err, "failed to check for existing bucket")
+	}
+
+	if existing != nil {
+		return p.existingBucket(logger, name, params, existing)
+	}
+
 	// Otherwise, create a new bucket.
 	req := client.CreateBucketJSONRequestBody{
 		GlobalAlias: &name,
@@ -63,7 +112,29 @@ func (p *provisionerServer) DriverCreateBucket(ctx context.Context, r *cosi.Driv
 	resp, err := p.client.CreateBucketWithResponse(ctx, req)
 	if err != nil {
 		logger.Error("Failed to create bucket", "error", err)
-		return nil, status.Error(codes.Internal, "failed to create bucket")
+		return nil, statusError(err, "failed to create bucket")
+	}
+
+	// Another driver replica might have created the bucket in the meantime.
+	if resp.StatusCode() == http.StatusConflict {
+		logger.Info("Bucket created concurrently, looking it up again")
+
+		existing, err := p.findBucket(ctx, "", name)
+		if err != nil {
+			logger.Error("Failed to check for existing bucket", "error", err)
+			return nil, statusError(err, "failed to check for existing bucket")
+		}
+
+		if existing == nil {
+			logger.Error("Failed to find bucket after conflict on create")
+			return nil, status.Error(codes.Internal, "failed to create bucket")
+		}
+
+		if p.index != nil {
+			p.index.set(name, *existing.Id)
+		}
+
+		return p.existingBucket(logger, name, params, existing)
 	}
 
 	if code := resp.StatusCode(); code != http.StatusOK {
@@ -71,11 +142,41 @@ func (p *provisionerServer) DriverCreateBucket(ctx context.Context, r *cosi.Driv
 			"httpStatusExpected", http.StatusOK,
 			"httpStatusGot", code)
 
-		return nil, status.Error(codes.Internal, "failed to create bucket")
+		return nil, statusError(newAPIError(code, resp.Body), "failed to create bucket")
+	}
+
+	bucketID := *resp.JSON200.Id
+
+	if p.index != nil {
+		p.index.set(name, bucketID)
+	}
+
+	// Apply bucket settings from BucketClass parameters.
+	if err := p.updateBucket(ctx, bucketID, params); err != nil {
+		logger.Error("Failed to update bucket", "error", err)
+
+		// Remove the bucket again, so a retry does not find a bucket without its settings.
+		p.rollbackBucket(ctx, logger, bucketID)
+
+		return nil, statusError(err, "failed to update bucket")
+	}
+
+	return &cosi.DriverCreateBucketResponse{
+		BucketId:   bucketID,
+		BucketInfo: p.protocol(),
+	}, nil
+}
+
+// existingBucket returns the response for an already existing bucket.
+// An existing bucket is only accepted if it matches the requested parameters.
+func (p *provisionerServer) existingBucket(logger *slog.Logger, name string, params *bucketParameters, info *client.BucketInfo) (*cosi.DriverCreateBucketResponse, error) {
+	if err := params.matches(name, info); err != nil {
+		logger.Error("Existing bucket does not match BucketClass parameters", "error", err)
+		return nil, status.Errorf(codes.AlreadyExists, "bucket already exists with different parameters: %s", err)
 	}
 
 	return &cosi.DriverCreateBucketResponse{
-		BucketId:   *resp.JSON200.Id,
+		BucketId:   *info.Id,
 		BucketInfo: p.protocol(),
 	}, nil
 }
@@ -89,10 +190,21 @@ func (p *provisionerServer) DriverDeleteBucket(ctx context.Context, r *cosi.Driv
 	logger := p.logger.With("req", r)
 	logger.Info("DriverDeleteBucket request")
 
-	resp, err := p.client.DeleteBucketWithResponse(ctx, &client.DeleteBucketParams{Id: r.GetBucketId()})
+	// Adopted buckets existed before COSI and are never deleted by the driver.
+	bucketID, adopted := parseBucketID(r.GetBucketId())
+	if adopted {
+		logger.Info("Skipping deletion of adopted bucket")
+		return &cosi.DriverDeleteBucketResponse{}, nil
+	}
+
+	if err := p.admission.admit(ctx, logger); err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.DeleteBucketWithResponse(ctx, &client.DeleteBucketParams{Id: bucketID})
 	if err != nil {
 		logger.Error("Failed to delete bucket", "error", err)
-		return nil, status.Error(codes.Internal, "failed to delete bucket")
+		return nil, statusError(err, "failed to delete bucket")
 	}
 
 	// If a bucket is not found, this is a no-op.
@@ -102,7 +214,11 @@ func (p *provisionerServer) DriverDeleteBucket(ctx context.Context, r *cosi.Driv
 			"httpStatusExpected", http.StatusNoContent,
 			"httpStatusGot", code)
 
-		return nil, status.Error(codes.Internal, "failed to delete bucket")
+		return nil, statusError(newAPIError(code, resp.Body), "failed to delete bucket")
+	}
+
+	if p.index != nil {
+		p.index.delete(bucketID)
 	}
 
 	return &cosi.DriverDeleteBucketResponse{}, nil
@@ -119,65 +235,150 @@ func (p *provisionerServer) DriverGrantBucketAccess(ctx context.Context, r *cosi
 		return nil, status.Error(codes.Unimplemented, "authentication type IAM not implemented")
 	}
 
-	// Create new API key.
-	// TODO: Tokens with same name are possible. Guard against it?
-	accountName := r.GetName()
-	keyResp, err := p.client.AddKeyWithResponse(ctx, client.AddKeyJSONRequestBody{Name: &accountName})
+	bucketID, _ := parseBucketID(r.GetBucketId())
+
+	// Validate parameters before any changes are made in Garage.
+	permissions, err := permissions(r.Parameters, p.profiles)
+	if err != nil {
+		logger.Error("Failed to parse BucketAccessClass parameters", "error", err)
+		return nil, status.Errorf(codes.InvalidArgument, "failed to parse BucketAccessClass parameters: %s", err)
+	}
+
+	createBucket, err := allowCreateBucket(r.Parameters, p.allowCreateBucket)
 	if err != nil {
-		logger.Error("Failed to create key", "error", err)
-		return nil, status.Error(codes.Internal, "failed to create key")
+		logger.Error("Failed to parse BucketAccessClass parameters", "error", err)
+		return nil, status.Errorf(codes.InvalidArgument, "failed to parse BucketAccessClass parameters: %s", err)
 	}
 
-	if code := keyResp.StatusCode(); code != http.StatusOK {
-		logger.Error("Failed to create key with unexpected HTTP status code",
-			"httpStatusExpected", http.StatusOK,
-			"httpStatusGot", code)
+	accountName, err := p.keyName.Render(naming.KeyNameData{
+		DriverName:  p.driverName,
+		BucketID:    bucketID,
+		AccountName: r.GetName(),
+	})
+	if err != nil {
+		logger.Error("Failed to render key name", "error", err)
+		return nil, status.Errorf(codes.InvalidArgument, "failed to render key name: %s", err)
+	}
 
-		return nil, status.Error(codes.Internal, "failed to create key")
+	if err := p.admission.admit(ctx, logger); err != nil {
+		return nil, err
 	}
 
-	s3AccessKeyID := *keyResp.JSON200.AccessKeyId
-	s3AccessKey := *keyResp.JSON200.SecretAccessKey
+	// Serialize concurrent requests for the same account.
+	unlock := p.accounts.lock(accountName)
+	defer unlock()
 
-	permissions, err := permissions(r.Parameters)
+	// Reuse a key from a previous attempt, since the sidecar retries grants.
+	key, err := p.findKey(ctx, accountName)
 	if err != nil {
-		logger.Error("Failed to parse BucketAccessClass parameters", "error", err)
-		return nil, status.Error(codes.InvalidArgument, "failed to parse BucketAccessClass parameters")
+		logger.Error("Failed to check for existing key", "error", err)
+		return nil, statusError(err, "failed to check for existing key")
 	}
 
-	// Assign key to bucket.
-	req := client.AllowBucketKeyJSONRequestBody{
-		AccessKeyId: s3AccessKeyID,
-		BucketId:    r.BucketId,
-		Permissions: struct {
-			Owner bool "json:\"owner\""
-			Read  bool "json:\"read\""
-			Write bool "json:\"write\""
-		}{
-			Owner: permissions.owner,
-			Read:  permissions.read,
-			Write: permissions.write,
-		},
+	created := false
+	if key == nil {
+		// Create new API key.
+		key, err = p.createKey(ctx, accountName)
+		if err != nil {
+			logger.Error("Failed to create key", "error", err)
+			return nil, statusError(err, "failed to create key")
+		}
+
+		created = true
 	}
 
-	allowResp, err := p.client.AllowBucketKeyWithResponse(ctx, req)
+	s3AccessKeyID := *key.AccessKeyId
+	s3AccessKey := *key.SecretAccessKey
+
+	// Only roll back keys created by this request.
+	rollback := func() {
+		if created {
+			p.rollbackKey(ctx, logger, s3AccessKeyID)
+		}
+	}
+
+	existing, attached, err := keyBucketPermissions(key, bucketID)
 	if err != nil {
-		logger.Error("Failed to assign key to bucket", "error", err)
-		return nil, status.Error(codes.Internal, "failed to assign key to bucket")
+		logger.Error("Existing key is assigned to another bucket", "error", err)
+		return nil, status.Error(codes.AlreadyExists, "key already exists for another bucket")
 	}
 
-	if code := allowResp.StatusCode(); code != http.StatusOK {
-		logger.Error("Failed to assign key to bucket with unexpected HTTP status code",
-			"httpStatusExpected", http.StatusOK,
-			"httpStatusGot", code)
+	if attached && *existing != *permissions {
+		logger.Error("Existing key has different permissions",
+			"permissionsExpected", fmt.Sprintf("%+v", *permissions),
+			"permissionsGot", fmt.Sprintf("%+v", *existing))
+
+		return nil, status.Error(codes.AlreadyExists, "key already exists with different permissions")
+	}
+
+	hasCreateBucket := key.Permissions != nil && key.Permissions.CreateBucket != nil && *key.Permissions.CreateBucket
+	if hasCreateBucket && !createBucket {
+		logger.Error("Existing key is allowed to create buckets")
+		return nil, status.Error(codes.AlreadyExists, "key already exists with different permissions")
+	}
+
+	// Allow key to create buckets.
+	if createBucket && !hasCreateBucket {
+		if err := p.allowKeyCreateBucket(ctx, s3AccessKeyID); err != nil {
+			logger.Error("Failed to allow key to create buckets", "error", err)
+			rollback()
+			return nil, statusError(err, "failed to allow key to create buckets")
+		}
+	}
+
+	// Assign key to bucket.
+	if !attached {
+		req := client.AllowBucketKeyJSONRequestBody{
+			AccessKeyId: s3AccessKeyID,
+			BucketId:    bucketID,
+			Permissions: struct {
+				Owner bool "json:\"owner\""
+				Read  bool "json:\"read\""
+				Write bool "json:\"write\""
+			}{
+				Owner: permissions.owner,
+				Read:  permissions.read,
+				Write: permissions.write,
+			},
+		}
 
-		return nil, status.Error(codes.Internal, "failed to assign key to bucket")
+		allowResp, err := p.client.AllowBucketKeyWithResponse(ctx, req)
+		if err != nil {
+			logger.Error("Failed to assign key to bucket", "error", err)
+			rollback()
+			return nil, statusError(err, "failed to assign key to bucket")
+		}
+
+		if code := allowResp.StatusCode(); code != http.StatusOK {
+			logger.Error("Failed to assign key to bucket with unexpected HTTP status code",
+				"httpStatusExpected", http.StatusOK,
+				"httpStatusGot", code)
+
+			rollback()
+			return nil, statusError(newAPIError(code, allowResp.Body), "failed to assign key to bucket")
+		}
+	}
+
+	credentials := p.s3Credentials(s3AccessKeyID, s3AccessKey)
+
+	// Add the public website URL if website access is enabled for the bucket.
+	if p.config.WebEndpoint != "" {
+		websiteURL, err := p.websiteURL(ctx, bucketID)
+		if err != nil {
+			logger.Error("Failed to get bucket website URL", "error", err)
+			rollback()
+			return nil, statusError(err, "failed to get bucket website URL")
+		}
+
+		if websiteURL != "" {
+			credentials.Secrets["websiteURL"] = websiteURL
+		}
 	}
 
 	return &cosi.DriverGrantBucketAccessResponse{
 		AccountId: s3AccessKeyID,
 		Credentials: map[string]*cosi.CredentialDetails{
-			"s3": p.s3Credentials(s3AccessKeyID, s3AccessKey),
+			"s3": credentials,
 		},
 	}, nil
 }
@@ -187,45 +388,356 @@ func (p *provisionerServer) DriverRevokeBucketAccess(ctx context.Context, r *cos
 	logger := p.logger.With("req", r)
 	logger.Info("DriverRevokeBucketAccess request")
 
+	if err := p.admission.admit(ctx, logger); err != nil {
+		return nil, err
+	}
+
 	resp, err := p.client.DeleteKeyWithResponse(ctx, &client.DeleteKeyParams{Id: r.AccountId})
 	if err != nil {
 		logger.Error("Failed to delete key", "error", err)
-		return nil, status.Error(codes.Internal, "failed to delete key")
+		return nil, statusError(err, "failed to delete key")
 	}
 
-	if code := resp.StatusCode(); code != http.StatusNoContent {
+	// If a key is not found, e.g. because a retried request deleted it already, this is a no-op.
+	if code := resp.StatusCode(); code != http.StatusNoContent && code != http.StatusNotFound {
 		logger.Error("Failed to delete key with unexpected HTTP status code",
 			"httpStatusExpected", http.StatusNoContent,
 			"httpStatusGot", code)
 
-		return nil, status.Error(codes.Internal, "failed to delete key")
+		return nil, statusError(newAPIError(code, resp.Body), "failed to delete key")
 	}
 
 	return &cosi.DriverRevokeBucketAccessResponse{}, nil
 }
 
-// hasBucket checks if a bucket already exists and returns its ID.
-func (p *provisionerServer) hasBucket(ctx context.Context, name string) (*string, error) {
-	list, err := p.client.ListBucketsWithResponse(ctx)
+// rollbackKey deletes a key created during a failed access grant, so no key without owner is left behind.
+// Failures are only logged, since the original error is returned to the caller.
+func (p *provisionerServer) rollbackKey(ctx context.Context, logger *slog.Logger, id string) {
+	// Roll back even if the request has been canceled.
+	ctx = context.WithoutCancel(ctx)
+
+	resp, err := p.client.DeleteKeyWithResponse(ctx, &client.DeleteKeyParams{Id: id})
+	if err != nil {
+		metrics.RolledBackKeys.WithLabelValues(metrics.ResultFailure).Inc()
+		logger.Error("Failed to roll back key", "accessKeyID", id, "error", err)
+
+		return
+	}
+
+	if code := resp.StatusCode(); code != http.StatusNoContent && code != http.StatusNotFound {
+		logger.Error("Failed to roll back key with unexpected HTTP status code",
+			"accessKeyID", id,
+			"httpStatusExpected", http.StatusNoContent,
+			"httpStatusGot", code)
+		metrics.RolledBackKeys.WithLabelValues(metrics.ResultFailure).Inc()
+
+		return
+	}
+
+	metrics.RolledBackKeys.WithLabelValues(metrics.ResultSuccess).Inc()
+	logger.Info("Rolled back key", "accessKeyID", id)
+}
+
+// rollbackBucket deletes a bucket created during a failed bucket creation, so a retry
+// does not find a bucket without its settings. Failures are only logged, since the
+// original error is returned to the caller.
+func (p *provisionerServer) rollbackBucket(ctx context.Context, logger *slog.Logger, id string) {
+	// Roll back even if the request has been canceled.
+	ctx = context.WithoutCancel(ctx)
+
+	resp, err := p.client.DeleteBucketWithResponse(ctx, &client.DeleteBucketParams{Id: id})
+	if err != nil {
+		logger.Error("Failed to roll back bucket", "bucketID", id, "error", err)
+		return
+	}
+
+	if code := resp.StatusCode(); code != http.StatusNoContent && code != http.StatusNotFound {
+		logger.Error("Failed to roll back bucket with unexpected HTTP status code",
+			"bucketID", id,
+			"httpStatusExpected", http.StatusNoContent,
+			"httpStatusGot", code)
+
+		return
+	}
+
+	if p.index != nil {
+		p.index.delete(id)
+	}
+
+	logger.Info("Rolled back bucket", "bucketID", id)
+}
+
+// createKey creates a new key with the given name.
+// Creating a key is not idempotent, so a failed attempt is only retried
+// after a lookup confirmed that the key has not been created anyway.
+func (p *provisionerServer) createKey(ctx context.Context, name string) (*client.KeyInfo, error) {
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			key, err := p.findKey(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+
+			if key != nil {
+				return key, nil
+			}
+		}
+
+		resp, err := p.client.AddKeyWithResponse(ctx, client.AddKeyJSONRequestBody{Name: &name})
+		if err == nil && resp.StatusCode() == http.StatusOK {
+			return resp.JSON200, nil
+		}
+
+		// Only connection errors and server errors are retried.
+		retryable := ctx.Err() == nil && (err != nil || resp.StatusCode() >= http.StatusInternalServerError)
+		if err == nil {
+			err = fmt.Errorf("error creating key: %w", newAPIError(resp.StatusCode(), resp.Body))
+		}
+
+		if !retryable || attempt >= p.retry.MaxAttempts || p.retry.Wait(ctx, attempt) != nil {
+			return nil, err
+		}
+	}
+}
+
+// allowKeyCreateBucket grants a key the global permission to create buckets.
+func (p *provisionerServer) allowKeyCreateBucket(ctx context.Context, id string) error {
+	allow := true
+	req := client.UpdateKeyJSONRequestBody{
+		Allow: &struct {
+			CreateBucket *bool "json:\"createBucket,omitempty\""
+		}{
+			CreateBucket: &allow,
+		},
+	}
+
+	resp, err := p.client.UpdateKeyWithResponse(ctx, &client.UpdateKeyParams{Id: id}, req)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("error updating key: %w", newAPIError(resp.StatusCode(), resp.Body))
+	}
+
+	return nil
+}
+
+// findKey looks up a key by its exact name and returns it including its secret.
+// If no key exists, nil is returned without error.
+func (p *provisionerServer) findKey(ctx context.Context, name string) (*client.KeyInfo, error) {
+	showSecretKey := client.True
+
+	resp, err := p.client.GetKeyWithResponse(ctx, &client.GetKeyParams{
+		Search:        &name,
+		ShowSecretKey: &showSecretKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusOK:
+		// A search also matches names with the same prefix.
+		if resp.JSON200.Name != nil && *resp.JSON200.Name == name {
+			return resp.JSON200, nil
+		}
+	case http.StatusNotFound:
+		return nil, nil
+	case http.StatusBadRequest:
+		// Ambiguous search pattern, fall back to listing all keys.
+	default:
+		return nil, fmt.Errorf("error getting key: %w", newAPIError(resp.StatusCode(), resp.Body))
+	}
+
+	list, err := p.client.ListKeysWithResponse(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	if list.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("error listing buckets, HTTP status code %d", list.StatusCode())
+		return nil, fmt.Errorf("error listing keys: %w", newAPIError(list.StatusCode(), list.Body))
 	}
 
 	var id *string
-	for _, l := range *list.JSON200 {
-		if l.GlobalAliases != nil {
-			if slices.Contains(*l.GlobalAliases, name) {
-				id = &l.Id
-				break
-			}
+	for _, k := range *list.JSON200 {
+		if k.Name == nil || *k.Name != name {
+			continue
+		}
+
+		if id != nil {
+			return nil, fmt.Errorf("multiple keys with name %q", name)
+		}
+
+		id = &k.Id
+	}
+
+	if id == nil {
+		return nil, nil
+	}
+
+	key, err := p.client.GetKeyWithResponse(ctx, &client.GetKeyParams{
+		Id:            id,
+		ShowSecretKey: &showSecretKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if key.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("error getting key: %w", newAPIError(key.StatusCode(), key.Body))
+	}
+
+	return key.JSON200, nil
+}
+
+// hasBucket checks if a bucket with the given global alias already exists and returns its info.
+// If the bucket index is enabled, only buckets known to the index are looked up.
+func (p *provisionerServer) hasBucket(ctx context.Context, name string) (*client.BucketInfo, error) {
+	if p.index == nil {
+		return p.findBucket(ctx, "", name)
+	}
+
+	id, ok := p.index.get(name)
+	if !ok {
+		return nil, nil
+	}
+
+	info, err := p.findBucket(ctx, id, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove stale index entries of buckets deleted outside of the driver.
+	if info == nil {
+		p.index.delete(id)
+	}
+
+	return info, nil
+}
+
+// getBucket returns the info of a bucket.
+func (p *provisionerServer) getBucket(ctx context.Context, id string) (*client.BucketInfo, error) {
+	resp, err := p.client.GetBucketInfoWithResponse(ctx, &client.GetBucketInfoParams{Id: &id})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("error getting bucket info: %w", newAPIError(resp.StatusCode(), resp.Body))
+	}
+
+	return resp.JSON200, nil
+}
+
+// findBucket looks up a bucket either by ID or by global alias.
+// If the bucket does not exist, nil is returned without error.
+func (p *provisionerServer) findBucket(ctx context.Context, id, alias string) (*client.BucketInfo, error) {
+	params := &client.GetBucketInfoParams{}
+	if id != "" {
+		params.Id = &id
+	} else {
+		params.Alias = &alias
+	}
+
+	resp, err := p.client.GetBucketInfoWithResponse(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusOK:
+		return resp.JSON200, nil
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("error getting bucket info: %w", newAPIError(resp.StatusCode(), resp.Body))
+	}
+}
+
+// adoptedBucketPrefix marks the COSI bucket ID of an adopted Garage bucket.
+const adoptedBucketPrefix = "adopted:"
+
+// parseBucketID returns the Garage bucket ID for a COSI bucket ID
+// and whether the bucket has been adopted.
+func parseBucketID(id string) (string, bool) {
+	if after, ok := strings.CutPrefix(id, adoptedBucketPrefix); ok {
+		return after, true
+	}
+
+	return id, false
+}
+
+// updateBucket applies the settings from BucketClass parameters to a bucket.
+func (p *provisionerServer) updateBucket(ctx context.Context, id string, params *bucketParameters) error {
+	if !params.hasQuotas() && !params.website {
+		return nil
+	}
+
+	req := client.UpdateBucketJSONRequestBody{}
+
+	if params.hasQuotas() {
+		req.Quotas = &struct {
+			MaxObjects *int64 "json:\"maxObjects\""
+			MaxSize    *int64 "json:\"maxSize\""
+		}{
+			MaxObjects: params.maxObjects,
+			MaxSize:    params.maxSize,
 		}
 	}
 
-	return id, nil
+	if params.website {
+		req.WebsiteAccess = &struct {
+			Enabled       *bool   "json:\"enabled,omitempty\""
+			ErrorDocument *string "json:\"errorDocument,omitempty\""
+			IndexDocument *string "json:\"indexDocument,omitempty\""
+		}{
+			Enabled:       &params.website,
+			IndexDocument: &params.indexDocument,
+		}
+
+		if params.errorDocument != "" {
+			req.WebsiteAccess.ErrorDocument = &params.errorDocument
+		}
+	}
+
+	resp, err := p.client.UpdateBucketWithResponse(ctx, &client.UpdateBucketParams{Id: id}, req)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("error updating bucket: %w", newAPIError(resp.StatusCode(), resp.Body))
+	}
+
+	return nil
+}
+
+// websiteURL returns the public website URL of a bucket.
+// An empty string is returned if website access is disabled.
+func (p *provisionerServer) websiteURL(ctx context.Context, id string) (string, error) {
+	info, err := p.getBucket(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	if info.WebsiteAccess == nil || !*info.WebsiteAccess {
+		return "", nil
+	}
+
+	if info.GlobalAliases == nil || len(*info.GlobalAliases) == 0 {
+		return "", errors.New("bucket with website access has no global alias")
+	}
+
+	endpoint, err := url.Parse(p.config.WebEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	// Garage serves websites on virtual hosts below the web root domain.
+	endpoint.Host = (*info.GlobalAliases)[0] + "." + endpoint.Host
+
+	return endpoint.String(), nil
 }
 
 // protocol returns details of supported object bucket protocols.
@@ -259,9 +771,53 @@ type accessPermissions struct {
 	write bool
 }
 
+// keyBucketPermissions returns the permissions of a key on a bucket and
+// whether the key is assigned to the bucket at all.
+// An error is returned if the key is assigned to other buckets.
+func keyBucketPermissions(key *client.KeyInfo, bucketID string) (*accessPermissions, bool, error) {
+	if key.Buckets == nil || len(*key.Buckets) == 0 {
+		return nil, false, nil
+	}
+
+	var p *accessPermissions
+	for _, b := range *key.Buckets {
+		if b.Id == nil || *b.Id != bucketID {
+			return nil, false, errors.New("key is assigned to another bucket")
+		}
+
+		p = &accessPermissions{}
+		if b.Permissions != nil {
+			p.owner = b.Permissions.Owner != nil && *b.Permissions.Owner
+			p.read = b.Permissions.Read != nil && *b.Permissions.Read
+			p.write = b.Permissions.Write != nil && *b.Permissions.Write
+		}
+	}
+
+	return p, true, nil
+}
+
+// permissionProfiles returns the built-in and the given custom permission profiles.
+// Custom profiles cannot override built-in ones, which is checked by config validation.
+func permissionProfiles(custom map[string]config.Permissions) map[string]accessPermissions {
+	profiles := map[string]accessPermissions{}
+
+	for _, m := range []map[string]config.Permissions{config.BuiltinPermissionProfiles, custom} {
+		for name, p := range m {
+			profiles[name] = accessPermissions{
+				owner: p.Owner,
+				read:  p.Read,
+				write: p.Write,
+			}
+		}
+	}
+
+	return profiles
+}
+
 // permissions parses the bucket access permissions from BucketAccessClass parameters.
+// A named profile sets all permissions at once, explicit permissions must not contradict it.
 // All permissions are disabled by default.
-func permissions(params map[string]string) (*accessPermissions, error) {
+func permissions(params map[string]string, profiles map[string]accessPermissions) (*accessPermissions, error) {
 	p := &accessPermissions{
 		owner: false,
 		read:  false,
@@ -272,32 +828,60 @@ func permissions(params map[string]string) (*accessPermissions, error) {
 		return p, nil
 	}
 
-	if v, ok := params["owner"]; ok {
-		b, err := strconv.ParseBool(v)
-		if err != nil {
-			return nil, err
+	profile, hasProfile := params["profile"]
+	if hasProfile {
+		preset, ok := profiles[profile]
+		if !ok {
+			return nil, fmt.Errorf("unknown permission profile %q", profile)
 		}
 
-		p.owner = b
+		*p = preset
 	}
 
-	if v, ok := params["read"]; ok {
-		b, err := strconv.ParseBool(v)
-		if err != nil {
-			return nil, err
+	for _, f := range []struct {
+		name  string
+		value *bool
+	}{
+		{"owner", &p.owner},
+		{"read", &p.read},
+		{"write", &p.write},
+	} {
+		v, ok := params[f.name]
+		if !ok {
+			continue
 		}
 
-		p.read = b
-	}
-
-	if v, ok := params["write"]; ok {
 		b, err := strconv.ParseBool(v)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("invalid %s: %w", f.name, err)
+		}
+
+		if hasProfile && b != *f.value {
+			return nil, fmt.Errorf("%s=%t conflicts with permission profile %q", f.name, b, profile)
 		}
 
-		p.write = b
+		*f.value = b
 	}
 
 	return p, nil
 }
+
+// allowCreateBucket parses the permission to create buckets from BucketAccessClass parameters.
+// It is disabled by default and can only be enabled if the driver permits it.
+func allowCreateBucket(params map[string]string, permitted bool) (bool, error) {
+	v, ok := params["allowCreateBucket"]
+	if !ok {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid allowCreateBucket: %w", err)
+	}
+
+	if b && !permitted {
+		return false, errors.New("allowCreateBucket is not permitted by the driver configuration")
+	}
+
+	return b, nil
+}
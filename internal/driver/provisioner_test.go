@@ -0,0 +1,312 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+
+	"github.com/mpreu/cosi-driver-garage/internal/client"
+	"github.com/mpreu/cosi-driver-garage/internal/config"
+	"github.com/mpreu/cosi-driver-garage/internal/health"
+	"github.com/mpreu/cosi-driver-garage/internal/naming"
+)
+
+// fakeGarage is an in-memory Garage admin API serving bucket requests.
+type fakeGarage struct {
+	mu      sync.Mutex
+	buckets map[string]*client.BucketInfo
+	aliases map[string]string
+	// creates counts CreateBucket requests.
+	creates int
+	// conflict makes CreateBucket create the bucket as another driver replica
+	// and respond with a conflict.
+	conflict bool
+}
+
+// newFakeGarage returns a fake admin API without buckets.
+func newFakeGarage() *fakeGarage {
+	return &fakeGarage{
+		buckets: map[string]*client.BucketInfo{},
+		aliases: map[string]string{},
+	}
+}
+
+// add adds a bucket with the given global alias and returns its ID.
+func (f *fakeGarage) add(alias string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.create(alias)
+}
+
+// create creates a bucket with the given global alias and returns its ID.
+func (f *fakeGarage) create(alias string) string {
+	id := fmt.Sprintf("%064x", len(f.buckets)+1)
+	f.buckets[id] = &client.BucketInfo{
+		Id:            &id,
+		GlobalAliases: &[]string{alias},
+	}
+	f.aliases[alias] = id
+
+	return id
+}
+
+// ServeHTTP implements http.Handler.
+func (f *fakeGarage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q := r.URL.Query()
+
+	switch {
+	case r.URL.Path != "/bucket":
+		http.NotFound(w, r)
+	case r.Method == http.MethodGet && q.Has("list"):
+		f.list(w)
+	case r.Method == http.MethodGet:
+		id := q.Get("id")
+		if alias := q.Get("alias"); alias != "" {
+			id = f.aliases[alias]
+		}
+
+		info, ok := f.buckets[id]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"code": "NoSuchBucket"})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, info)
+	case r.Method == http.MethodPost:
+		f.creates++
+
+		var req client.CreateBucketJSONRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.GlobalAlias == nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"code": "InvalidRequest"})
+			return
+		}
+
+		if _, ok := f.aliases[*req.GlobalAlias]; ok {
+			writeJSON(w, http.StatusConflict, map[string]string{"code": "BucketAlreadyExists"})
+			return
+		}
+
+		id := f.create(*req.GlobalAlias)
+		if f.conflict {
+			writeJSON(w, http.StatusConflict, map[string]string{"code": "BucketAlreadyExists"})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, f.buckets[id])
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// list writes all buckets in the format of ListBuckets.
+func (f *fakeGarage) list(w http.ResponseWriter) {
+	type item struct {
+		ID            string   `json:"id"`
+		GlobalAliases []string `json:"globalAliases"`
+	}
+
+	items := make([]item, 0, len(f.buckets))
+	for id, info := range f.buckets {
+		items = append(items, item{ID: id, GlobalAliases: *info.GlobalAliases})
+	}
+
+	writeJSON(w, http.StatusOK, items)
+}
+
+// writeJSON writes a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// newTestProvisioner returns a provisioner using the admin API at the given URL.
+func newTestProvisioner(tb testing.TB, url string) *provisionerServer {
+	tb.Helper()
+
+	c, err := client.NewClientWithResponses(url)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	bucketAlias, err := naming.NewBucketAliasTemplate("{{.Name}}", "", "garage.objectstorage.k8s.io")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return &provisionerServer{
+		client:      c,
+		config:      &config.Garage{Region: "garage"},
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		names:       newKeyedMutex(),
+		accounts:    newKeyedMutex(),
+		bucketAlias: bucketAlias,
+		admission:   newAdmission(health.NewCache(c, 0), c, config.AdmissionOff, 0),
+	}
+}
+
+func TestDriverCreateBucketConcurrent(t *testing.T) {
+	const requests = 16
+
+	tests := []struct {
+		name     string
+		conflict bool
+	}{
+		{"create", false},
+		{"conflict", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			garage := newFakeGarage()
+			garage.conflict = tt.conflict
+
+			srv := httptest.NewServer(garage)
+			defer srv.Close()
+
+			p := newTestProvisioner(t, srv.URL)
+
+			ids := make([]string, requests)
+			errs := make([]error, requests)
+
+			var wg sync.WaitGroup
+			for i := range requests {
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+
+					resp, err := p.DriverCreateBucket(context.Background(), &cosi.DriverCreateBucketRequest{Name: "bucket"})
+					if err != nil {
+						errs[i] = err
+						return
+					}
+
+					ids[i] = resp.BucketId
+				}()
+			}
+
+			wg.Wait()
+
+			for i, err := range errs {
+				if err != nil {
+					t.Fatalf("request %d: %v", i, err)
+				}
+			}
+
+			garage.mu.Lock()
+			defer garage.mu.Unlock()
+
+			if garage.creates != 1 {
+				t.Errorf("got %d CreateBucket requests, want 1", garage.creates)
+			}
+
+			want := garage.aliases["bucket"]
+			for i, id := range ids {
+				if id != want {
+					t.Errorf("request %d: got bucket ID %q, want %q", i, id, want)
+				}
+			}
+		})
+	}
+}
+
+// scanBuckets looks up a bucket by listing all buckets, as hasBucket did before
+// looking up buckets by alias.
+func scanBuckets(ctx context.Context, p *provisionerServer, name string) (*client.BucketInfo, error) {
+	list, err := p.client.ListBucketsWithResponse(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if list.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("error listing buckets, HTTP status code %d", list.StatusCode())
+	}
+
+	for _, l := range *list.JSON200 {
+		if l.GlobalAliases != nil && slices.Contains(*l.GlobalAliases, name) {
+			return p.getBucket(ctx, l.Id)
+		}
+	}
+
+	return nil, nil
+}
+
+// benchmarkBuckets is the number of buckets in the fake admin API of benchmarks.
+const benchmarkBuckets = 10000
+
+func BenchmarkHasBucket(b *testing.B) {
+	ctx := context.Background()
+
+	garage := newFakeGarage()
+	for i := range benchmarkBuckets {
+		garage.add(fmt.Sprintf("bucket-%05d", i))
+	}
+
+	srv := httptest.NewServer(garage)
+	defer srv.Close()
+
+	p := newTestProvisioner(b, srv.URL)
+
+	indexed := newTestProvisioner(b, srv.URL)
+	indexed.index = newBucketIndex()
+	if err := indexed.index.load(ctx, indexed.client); err != nil {
+		b.Fatal(err)
+	}
+
+	lookups := []struct {
+		name   string
+		lookup func(context.Context, string) (*client.BucketInfo, error)
+	}{
+		{"ListBuckets", func(ctx context.Context, name string) (*client.BucketInfo, error) {
+			return scanBuckets(ctx, p, name)
+		}},
+		{"GetBucketInfo", p.hasBucket},
+		{"BucketIndex", indexed.hasBucket},
+	}
+
+	buckets := []struct {
+		name   string
+		alias  string
+		exists bool
+	}{
+		{"existing", fmt.Sprintf("bucket-%05d", benchmarkBuckets/2), true},
+		{"missing", "bucket-missing", false},
+	}
+
+	for _, l := range lookups {
+		for _, bucket := range buckets {
+			b.Run(l.name+"/"+bucket.name, func(b *testing.B) {
+				info, err := l.lookup(ctx, bucket.alias)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				if (info != nil) != bucket.exists {
+					b.Fatalf("got bucket %v, want exists %t", info, bucket.exists)
+				}
+
+				b.ResetTimer()
+
+				for range b.N {
+					if _, err := l.lookup(ctx, bucket.alias); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
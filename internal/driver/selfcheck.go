@@ -0,0 +1,47 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/mpreu/cosi-driver-garage/internal/client"
+	"github.com/mpreu/cosi-driver-garage/internal/health"
+)
+
+// SelfCheck verifies that the Garage admin API is reachable, the cluster is available
+// and the admin token is accepted. The returned error describes the failing step.
+func SelfCheck(ctx context.Context, c client.ClientWithResponsesInterface) error {
+	resp, err := c.GetHealthWithResponse(ctx)
+	if err != nil {
+		return fmt.Errorf("error connecting to the Garage admin API: %w", err)
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("Garage admin token was rejected: %w", newAPIError(resp.StatusCode(), resp.Body))
+	default:
+		return fmt.Errorf("error getting Garage health: %w", newAPIError(resp.StatusCode(), resp.Body))
+	}
+
+	if h := resp.JSON200; h != nil && h.Status == health.StatusUnavailable {
+		return fmt.Errorf("Garage cluster is unavailable: %d of %d partitions have quorum, %d of %d nodes connected",
+			h.PartitionsQuorum, h.Partitions, h.ConnectedNodes, h.KnownNodes)
+	}
+
+	// Listing buckets is a cheap call that requires a valid admin token.
+	list, err := c.ListBucketsWithResponse(ctx)
+	if err != nil {
+		return fmt.Errorf("error connecting to the Garage admin API: %w", err)
+	}
+
+	switch list.StatusCode() {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("Garage admin token was rejected: %w", newAPIError(list.StatusCode(), list.Body))
+	default:
+		return fmt.Errorf("error listing buckets: %w", newAPIError(list.StatusCode(), list.Body))
+	}
+}
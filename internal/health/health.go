@@ -0,0 +1,162 @@
+// Package health implements the health, readiness and liveness endpoints of the driver
+// and caches the cluster health reported by Garage.
+package health
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mpreu/cosi-driver-garage/internal/client"
+)
+
+// Garage cluster health states.
+const (
+	// StatusHealthy means that all nodes and partitions are fine.
+	StatusHealthy = "healthy"
+	// StatusDegraded means that nodes are down, but all partitions have quorum.
+	StatusDegraded = "degraded"
+	// StatusUnavailable means that partitions lack quorum.
+	StatusUnavailable = "unavailable"
+)
+
+// Status is the cluster health reported by the Garage admin API.
+type Status struct {
+	ConnectedNodes   int64
+	KnownNodes       int64
+	Partitions       int64
+	PartitionsAllOk  int64
+	PartitionsQuorum int64
+	Status           string
+	StorageNodes     int64
+	StorageNodesOk   int64
+}
+
+// Cache caches the Garage cluster health for a short time
+// to avoid an admin API call on every check.
+type Cache struct {
+	client client.ClientWithResponsesInterface
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	checked time.Time
+	status  *Status
+	err     error
+}
+
+// NewCache returns a cache that keeps the cluster health for the given duration.
+func NewCache(c client.ClientWithResponsesInterface, ttl time.Duration) *Cache {
+	return &Cache{
+		client: c,
+		ttl:    ttl,
+	}
+}
+
+// Get returns the cluster health, which is queried from Garage if the cached one expired.
+// Concurrent callers wait for a single query.
+func (c *Cache) Get(ctx context.Context) (*Status, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.checked.IsZero() && time.Since(c.checked) < c.ttl {
+		return c.status, c.err
+	}
+
+	status, err := c.query(ctx)
+
+	// Do not cache the result of a canceled check, e.g. by a probe timeout.
+	if ctx.Err() != nil {
+		return status, err
+	}
+
+	c.checked = time.Now()
+	c.status, c.err = status, err
+
+	return status, err
+}
+
+// query gets the cluster health from the Garage admin API.
+func (c *Cache) query(ctx context.Context) (*Status, error) {
+	resp, err := c.client.GetHealthWithResponse(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != http.StatusOK || resp.JSON200 == nil {
+		return nil, fmt.Errorf("error getting Garage health: HTTP status code %d", resp.StatusCode())
+	}
+
+	status := Status(*resp.JSON200)
+
+	return &status, nil
+}
+
+// Server serves /healthz and /livez, which report that the process is alive,
+// and /readyz, which reports if COSI requests are served and Garage is healthy.
+type Server struct {
+	garage  *Cache
+	logger  *slog.Logger
+	serving atomic.Bool
+}
+
+// NewServer returns a health server. The driver is not ready until SetServing is called.
+func NewServer(garage *Cache, logger *slog.Logger) *Server {
+	return &Server{
+		garage: garage,
+		logger: logger,
+	}
+}
+
+// SetServing sets whether the COSI server is running.
+func (s *Server) SetServing(serving bool) {
+	s.serving.Store(serving)
+}
+
+// Handler returns the HTTP handler of the health endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.live)
+	mux.HandleFunc("GET /livez", s.live)
+	mux.HandleFunc("GET /readyz", s.ready)
+
+	return mux
+}
+
+// live reports that the process is alive.
+func (s *Server) live(w http.ResponseWriter, _ *http.Request) {
+	respond(w, http.StatusOK, "ok")
+}
+
+// ready reports if the COSI server is running and the Garage cluster is healthy.
+func (s *Server) ready(w http.ResponseWriter, r *http.Request) {
+	if !s.serving.Load() {
+		respond(w, http.StatusServiceUnavailable, "COSI server is not running")
+		return
+	}
+
+	status, err := s.garage.Get(r.Context())
+	if err != nil {
+		s.logger.Warn("Garage is not reachable", "error", err)
+		respond(w, http.StatusServiceUnavailable, "Garage is not reachable")
+
+		return
+	}
+
+	if status.Status != StatusHealthy {
+		respond(w, http.StatusServiceUnavailable, fmt.Sprintf("Garage cluster is %s", status.Status))
+		return
+	}
+
+	respond(w, http.StatusOK, "ok")
+}
+
+// respond writes a plain text response.
+func respond(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	_, _ = fmt.Fprintln(w, msg)
+}
@@ -0,0 +1,262 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mpreu/cosi-driver-garage/internal/client"
+)
+
+// Quota label values of the quota utilization metric.
+const (
+	quotaMaxSize    = "maxSize"
+	quotaMaxObjects = "maxObjects"
+)
+
+var bucketLabels = []string{"bucket_id", "alias"}
+
+var (
+	bucketBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bucket", "bytes"),
+		"Size of the objects in a Garage bucket.",
+		bucketLabels, nil)
+	bucketObjectsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bucket", "objects"),
+		"Number of objects in a Garage bucket.",
+		bucketLabels, nil)
+	bucketUnfinishedUploadsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bucket", "unfinished_uploads"),
+		"Number of unfinished multipart uploads in a Garage bucket.",
+		bucketLabels, nil)
+	bucketQuotaMaxSizeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bucket", "quota_max_size_bytes"),
+		"Size quota of a Garage bucket. Absent if the bucket has no size quota.",
+		bucketLabels, nil)
+	bucketQuotaMaxObjectsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bucket", "quota_max_objects"),
+		"Object quota of a Garage bucket. Absent if the bucket has no object quota.",
+		bucketLabels, nil)
+	bucketQuotaUtilizationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bucket", "quota_utilization_ratio"),
+		"Usage of a Garage bucket relative to its quota.",
+		append(bucketLabels, "quota"), nil)
+)
+
+// BucketPollErrors counts failed admin API calls while polling bucket usage.
+var BucketPollErrors = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "bucket",
+	Name:      "usage_poll_errors_total",
+	Help:      "Number of failed Garage admin API calls while polling bucket usage.",
+})
+
+// bucketUsage is the usage of a bucket at the last poll.
+type bucketUsage struct {
+	id                string
+	alias             string
+	bytes             int64
+	objects           int64
+	unfinishedUploads int64
+	maxSize           *int64
+	maxObjects        *int64
+}
+
+// BucketCollector polls the usage of the Garage buckets managed by the driver
+// and exports it as Prometheus metrics. Managed buckets are recognized by their
+// alias prefix, so adopted buckets and buckets created without it are left out.
+type BucketCollector struct {
+	client      client.ClientWithResponsesInterface
+	aliasPrefix string
+	concurrency int
+	logger      *slog.Logger
+
+	mu      sync.RWMutex
+	buckets []bucketUsage
+}
+
+// NewBucketCollector returns a collector for buckets with a global alias starting with aliasPrefix.
+// At most concurrency bucket infos are requested at the same time.
+func NewBucketCollector(c client.ClientWithResponsesInterface, aliasPrefix string, concurrency int, logger *slog.Logger) *BucketCollector {
+	return &BucketCollector{
+		client:      c,
+		aliasPrefix: aliasPrefix,
+		concurrency: concurrency,
+		logger:      logger,
+	}
+}
+
+// Run polls the bucket usage in the given interval until the context is done.
+func (b *BucketCollector) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		if err := b.poll(ctx); err != nil && ctx.Err() == nil {
+			BucketPollErrors.Inc()
+			b.logger.Error("Failed to poll bucket usage", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// poll lists the managed buckets and gets their usage with bounded concurrency.
+// Buckets whose info cannot be retrieved are left out until the next poll.
+func (b *BucketCollector) poll(ctx context.Context) error {
+	list, err := b.client.ListBucketsWithResponse(ctx)
+	if err != nil {
+		return err
+	}
+
+	if list.StatusCode() != http.StatusOK || list.JSON200 == nil {
+		return fmt.Errorf("error listing buckets: HTTP status code %d", list.StatusCode())
+	}
+
+	var managed []bucketUsage
+	for _, l := range *list.JSON200 {
+		if alias, ok := b.managedAlias(l.GlobalAliases); ok {
+			managed = append(managed, bucketUsage{id: l.Id, alias: alias})
+		}
+	}
+
+	results := make([]*bucketUsage, len(managed))
+	sem := make(chan struct{}, b.concurrency)
+
+	var wg sync.WaitGroup
+	for i := range managed {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			u, err := b.usage(ctx, managed[i])
+			if err != nil {
+				if ctx.Err() == nil {
+					BucketPollErrors.Inc()
+					b.logger.Warn("Failed to get bucket usage", "bucketID", managed[i].id, "error", err)
+				}
+
+				return
+			}
+
+			results[i] = u
+		}()
+	}
+
+	wg.Wait()
+
+	buckets := make([]bucketUsage, 0, len(results))
+	for _, u := range results {
+		if u != nil {
+			buckets = append(buckets, *u)
+		}
+	}
+
+	b.mu.Lock()
+	b.buckets = buckets
+	b.mu.Unlock()
+
+	return nil
+}
+
+// managedAlias returns the first global alias with the alias prefix of managed buckets.
+func (b *BucketCollector) managedAlias(aliases *[]string) (string, bool) {
+	if aliases == nil {
+		return "", false
+	}
+
+	for _, alias := range *aliases {
+		if strings.HasPrefix(alias, b.aliasPrefix) {
+			return alias, true
+		}
+	}
+
+	return "", false
+}
+
+// usage gets the usage of a bucket.
+func (b *BucketCollector) usage(ctx context.Context, u bucketUsage) (*bucketUsage, error) {
+	resp, err := b.client.GetBucketInfoWithResponse(ctx, &client.GetBucketInfoParams{Id: &u.id})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != http.StatusOK || resp.JSON200 == nil {
+		return nil, fmt.Errorf("error getting bucket info: HTTP status code %d", resp.StatusCode())
+	}
+
+	info := resp.JSON200
+	if info.Bytes != nil {
+		u.bytes = *info.Bytes
+	}
+
+	if info.Objects != nil {
+		u.objects = *info.Objects
+	}
+
+	if info.UnfinishedUploads != nil {
+		u.unfinishedUploads = int64(*info.UnfinishedUploads)
+	}
+
+	if info.Quotas != nil {
+		u.maxSize = info.Quotas.MaxSize
+		u.maxObjects = info.Quotas.MaxObjects
+	}
+
+	return &u, nil
+}
+
+// Describe implements prometheus.Collector.
+func (b *BucketCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- bucketBytesDesc
+	ch <- bucketObjectsDesc
+	ch <- bucketUnfinishedUploadsDesc
+	ch <- bucketQuotaMaxSizeDesc
+	ch <- bucketQuotaMaxObjectsDesc
+	ch <- bucketQuotaUtilizationDesc
+}
+
+// Collect implements prometheus.Collector with the usage of the last poll.
+func (b *BucketCollector) Collect(ch chan<- prometheus.Metric) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, u := range b.buckets {
+		ch <- prometheus.MustNewConstMetric(bucketBytesDesc, prometheus.GaugeValue, float64(u.bytes), u.id, u.alias)
+		ch <- prometheus.MustNewConstMetric(bucketObjectsDesc, prometheus.GaugeValue, float64(u.objects), u.id, u.alias)
+		ch <- prometheus.MustNewConstMetric(bucketUnfinishedUploadsDesc, prometheus.GaugeValue, float64(u.unfinishedUploads), u.id, u.alias)
+
+		if u.maxSize != nil {
+			ch <- prometheus.MustNewConstMetric(bucketQuotaMaxSizeDesc, prometheus.GaugeValue, float64(*u.maxSize), u.id, u.alias)
+
+			if *u.maxSize > 0 {
+				ch <- prometheus.MustNewConstMetric(bucketQuotaUtilizationDesc, prometheus.GaugeValue,
+					float64(u.bytes)/float64(*u.maxSize), u.id, u.alias, quotaMaxSize)
+			}
+		}
+
+		if u.maxObjects != nil {
+			ch <- prometheus.MustNewConstMetric(bucketQuotaMaxObjectsDesc, prometheus.GaugeValue, float64(*u.maxObjects), u.id, u.alias)
+
+			if *u.maxObjects > 0 {
+				ch <- prometheus.MustNewConstMetric(bucketQuotaUtilizationDesc, prometheus.GaugeValue,
+					float64(u.objects)/float64(*u.maxObjects), u.id, u.alias, quotaMaxObjects)
+			}
+		}
+	}
+}
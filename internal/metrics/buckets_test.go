@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mpreu/cosi-driver-garage/internal/client"
+)
+
+// testBucket is a bucket of the fake admin API.
+type testBucket struct {
+	id      string
+	aliases []string
+	bytes   int64
+}
+
+// fakeBuckets returns a fake admin API serving ListBuckets and GetBucketInfo for the given buckets.
+func fakeBuckets(buckets []testBucket) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.URL.Query().Has("list") {
+			type item struct {
+				ID            string   `json:"id"`
+				GlobalAliases []string `json:"globalAliases"`
+			}
+
+			var items []item
+			for _, b := range buckets {
+				items = append(items, item{ID: b.id, GlobalAliases: b.aliases})
+			}
+
+			_ = json.NewEncoder(w).Encode(items)
+
+			return
+		}
+
+		for _, b := range buckets {
+			if b.id == r.URL.Query().Get("id") {
+				_ = json.NewEncoder(w).Encode(client.BucketInfo{Id: &b.id, GlobalAliases: &b.aliases, Bytes: &b.bytes})
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	})
+}
+
+// TestBucketCollectorManagedBuckets documents that managed buckets are selected by the
+// alias prefix only: buckets with other aliases, e.g. created before the prefix was
+// configured or adopted, are not exported.
+func TestBucketCollectorManagedBuckets(t *testing.T) {
+	srv := httptest.NewServer(fakeBuckets([]testBucket{
+		{id: "1", aliases: []string{"cosi-a"}, bytes: 1},
+		{id: "2", aliases: []string{"legacy-b", "cosi-b"}, bytes: 2},
+		{id: "3", aliases: []string{"legacy-c"}, bytes: 3},
+		{id: "4", aliases: []string{"adopted"}, bytes: 4},
+		{id: "5", bytes: 5},
+	}))
+	defer srv.Close()
+
+	c, err := client.NewClientWithResponses(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBucketCollector(c, "cosi-", 2, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := b.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := b.buckets
+	slices.SortFunc(got, func(a, b bucketUsage) int { return strings.Compare(a.id, b.id) })
+
+	want := []bucketUsage{
+		{id: "1", alias: "cosi-a", bytes: 1},
+		{id: "2", alias: "cosi-b", bytes: 2},
+	}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("got buckets %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,231 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mpreu/cosi-driver-garage/internal/client"
+	"github.com/mpreu/cosi-driver-garage/internal/health"
+)
+
+// Label values of staged role changes.
+const (
+	roleChangeUpdate = "update"
+	roleChangeRemove = "remove"
+)
+
+// clusterStatuses are the cluster health states exported with value 0 or 1.
+var clusterStatuses = []string{health.StatusHealthy, health.StatusDegraded, health.StatusUnavailable}
+
+// clusterDesc returns the description of a cluster metric.
+func clusterDesc(name, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "cluster", name), help, labels, nil)
+}
+
+var (
+	clusterStatusDesc           = clusterDesc("status", "Health status of the Garage cluster, 1 for the current status.", "status")
+	clusterKnownNodesDesc       = clusterDesc("known_nodes", "Number of nodes known to the Garage cluster.")
+	clusterConnectedNodesDesc   = clusterDesc("connected_nodes", "Number of nodes connected to the Garage cluster.")
+	clusterStorageNodesDesc     = clusterDesc("storage_nodes", "Number of storage nodes in the Garage cluster layout.")
+	clusterStorageNodesOkDesc   = clusterDesc("storage_nodes_ok", "Number of connected storage nodes.")
+	clusterPartitionsDesc       = clusterDesc("partitions", "Number of partitions of the Garage cluster.")
+	clusterPartitionsQuorumDesc = clusterDesc("partitions_quorum", "Number of partitions with a quorum of connected nodes.")
+	clusterPartitionsAllOkDesc  = clusterDesc("partitions_all_ok", "Number of partitions with all nodes connected.")
+	clusterNodeUpDesc           = clusterDesc("node_up", "Whether a Garage node is connected, 1 if it is up.", "node_id", "hostname")
+	clusterLayoutVersionDesc    = clusterDesc("layout_version", "Version of the applied Garage cluster layout.")
+	clusterLayoutRolesDesc      = clusterDesc("layout_roles", "Number of node roles in the applied Garage cluster layout.")
+	clusterStagedChangesDesc    = clusterDesc("layout_staged_role_changes", "Number of staged but not applied role changes by type.", "type")
+)
+
+// ClusterPollErrors counts failed admin API calls while polling the cluster state.
+var ClusterPollErrors = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "cluster",
+	Name:      "poll_errors_total",
+	Help:      "Number of failed Garage admin API calls while polling the cluster state.",
+})
+
+// clusterState is the cluster state at the last poll. Parts which could not be retrieved are nil.
+type clusterState struct {
+	health *health.Status
+	nodes  []client.NodeNetworkInfo
+	layout *client.ClusterLayout
+}
+
+// ClusterCollector polls the health, nodes and layout of the Garage cluster
+// and exports them as Prometheus metrics.
+type ClusterCollector struct {
+	client client.ClientWithResponsesInterface
+	logger *slog.Logger
+
+	mu    sync.RWMutex
+	state clusterState
+}
+
+// NewClusterCollector returns a collector for the Garage cluster state.
+func NewClusterCollector(c client.ClientWithResponsesInterface, logger *slog.Logger) *ClusterCollector {
+	return &ClusterCollector{
+		client: c,
+		logger: logger,
+	}
+}
+
+// Run polls the cluster state in the given interval until the context is done.
+func (c *ClusterCollector) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		if err := c.poll(ctx); err != nil && ctx.Err() == nil {
+			c.logger.Error("Failed to poll cluster state", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// poll gets the cluster health, nodes and layout. Failed calls are counted
+// and leave out their metrics until the next poll.
+func (c *ClusterCollector) poll(ctx context.Context) error {
+	var state clusterState
+	var errs []error
+
+	status, err := c.health(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	state.health = status
+
+	nodes, err := c.client.GetNodesWithResponse(ctx)
+	switch {
+	case err != nil:
+		errs = append(errs, err)
+	case nodes.StatusCode() != http.StatusOK || nodes.JSON200 == nil:
+		errs = append(errs, fmt.Errorf("error getting nodes: HTTP status code %d", nodes.StatusCode()))
+	default:
+		state.nodes = nodes.JSON200.KnownNodes
+	}
+
+	layout, err := c.client.GetLayoutWithResponse(ctx)
+	switch {
+	case err != nil:
+		errs = append(errs, err)
+	case layout.StatusCode() != http.StatusOK || layout.JSON200 == nil:
+		errs = append(errs, fmt.Errorf("error getting cluster layout: HTTP status code %d", layout.StatusCode()))
+	default:
+		state.layout = layout.JSON200
+	}
+
+	ClusterPollErrors.Add(float64(len(errs)))
+
+	c.mu.Lock()
+	c.state = state
+	c.mu.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// health gets the cluster health.
+func (c *ClusterCollector) health(ctx context.Context) (*health.Status, error) {
+	resp, err := c.client.GetHealthWithResponse(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != http.StatusOK || resp.JSON200 == nil {
+		return nil, fmt.Errorf("error getting cluster health: HTTP status code %d", resp.StatusCode())
+	}
+
+	status := health.Status(*resp.JSON200)
+
+	return &status, nil
+}
+
+// Describe implements prometheus.Collector.
+func (c *ClusterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- clusterStatusDesc
+	ch <- clusterKnownNodesDesc
+	ch <- clusterConnectedNodesDesc
+	ch <- clusterStorageNodesDesc
+	ch <- clusterStorageNodesOkDesc
+	ch <- clusterPartitionsDesc
+	ch <- clusterPartitionsQuorumDesc
+	ch <- clusterPartitionsAllOkDesc
+	ch <- clusterNodeUpDesc
+	ch <- clusterLayoutVersionDesc
+	ch <- clusterLayoutRolesDesc
+	ch <- clusterStagedChangesDesc
+}
+
+// Collect implements prometheus.Collector with the state of the last poll.
+func (c *ClusterCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	gauge := func(desc *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, labels...)
+	}
+
+	if h := c.state.health; h != nil {
+		for _, s := range clusterStatuses {
+			gauge(clusterStatusDesc, boolValue(h.Status == s), s)
+		}
+
+		gauge(clusterKnownNodesDesc, float64(h.KnownNodes))
+		gauge(clusterConnectedNodesDesc, float64(h.ConnectedNodes))
+		gauge(clusterStorageNodesDesc, float64(h.StorageNodes))
+		gauge(clusterStorageNodesOkDesc, float64(h.StorageNodesOk))
+		gauge(clusterPartitionsDesc, float64(h.Partitions))
+		gauge(clusterPartitionsQuorumDesc, float64(h.PartitionsQuorum))
+		gauge(clusterPartitionsAllOkDesc, float64(h.PartitionsAllOk))
+	}
+
+	for _, n := range c.state.nodes {
+		if n.Id != nil {
+			gauge(clusterNodeUpDesc, boolValue(n.IsUp), *n.Id, n.Hostname)
+		}
+	}
+
+	if l := c.state.layout; l != nil {
+		gauge(clusterLayoutVersionDesc, float64(l.Version))
+		gauge(clusterLayoutRolesDesc, float64(len(l.Roles)))
+
+		updates, removes := stagedRoleChanges(l.StagedRoleChanges)
+		gauge(clusterStagedChangesDesc, float64(updates), roleChangeUpdate)
+		gauge(clusterStagedChangesDesc, float64(removes), roleChangeRemove)
+	}
+}
+
+// stagedRoleChanges counts role updates and removals.
+func stagedRoleChanges(changes []client.NodeRoleChange) (updates, removes int) {
+	for _, change := range changes {
+		if r, err := change.AsNodeRoleRemove(); err == nil && r.Remove {
+			removes++
+		} else {
+			updates++
+		}
+	}
+
+	return updates, removes
+}
+
+// boolValue returns 1 for true and 0 for false.
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
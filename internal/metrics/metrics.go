@@ -0,0 +1,106 @@
+// Package metrics defines the Prometheus metrics of the driver.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes all metrics of the driver.
+const namespace = "cosi_garage"
+
+// Rollback results.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// durationBuckets covers requests from milliseconds up to slow provisioning with retries.
+var durationBuckets = prometheus.ExponentialBuckets(0.005, 2, 15) //nolint:mnd // 5ms to ~82s.
+
+// Registry contains all metrics of the driver.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// RPCRequests counts COSI requests by method and gRPC status code.
+	RPCRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "requests_total",
+		Help:      "Number of COSI requests by method and gRPC status code.",
+	}, []string{"method", "code"})
+
+	// RPCDuration observes the latency of COSI requests by method and gRPC status code.
+	RPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of COSI requests by method and gRPC status code.",
+		Buckets:   durationBuckets,
+	}, []string{"method", "code"})
+
+	// RPCInFlight is the number of COSI requests being served by method.
+	RPCInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "requests_in_flight",
+		Help:      "Number of COSI requests being served by method.",
+	}, []string{"method"})
+
+	// AdminRequests counts Garage admin API calls by operation and HTTP status code.
+	AdminRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "admin",
+		Name:      "requests_total",
+		Help:      "Number of Garage admin API calls by operation and HTTP status code.",
+	}, []string{"operation", "status"})
+
+	// AdminDuration observes the latency of Garage admin API calls by operation and HTTP status code.
+	AdminDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "admin",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of Garage admin API calls by operation and HTTP status code.",
+		Buckets:   durationBuckets,
+	}, []string{"operation", "status"})
+
+	// AdminInFlight is the number of running Garage admin API calls by operation.
+	AdminInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "admin",
+		Name:      "requests_in_flight",
+		Help:      "Number of running Garage admin API calls by operation.",
+	}, []string{"operation"})
+
+	// RolledBackKeys counts keys deleted again after a failed access grant by result.
+	// Failures leave orphaned keys in Garage.
+	RolledBackKeys = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rolled_back_keys_total",
+		Help:      "Number of keys deleted after a failed access grant by result. Failures leave orphaned keys.",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RPCRequests,
+		RPCDuration,
+		RPCInFlight,
+		AdminRequests,
+		AdminDuration,
+		AdminInFlight,
+		RolledBackKeys,
+		BucketPollErrors,
+		ClusterPollErrors,
+	)
+}
+
+// Handler returns the HTTP handler serving the metrics in the Prometheus format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
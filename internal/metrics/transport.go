@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mpreu/cosi-driver-garage/internal/client"
+)
+
+// statusError labels calls that failed without an HTTP response.
+const statusError = "error"
+
+// Transport is a http.RoundTripper recording metrics of Garage admin API calls.
+type Transport struct {
+	Next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	op := client.Operation(req)
+
+	AdminInFlight.WithLabelValues(op).Inc()
+	defer AdminInFlight.WithLabelValues(op).Dec()
+
+	start := time.Now()
+	resp, err := t.Next.RoundTrip(req)
+
+	status := statusError
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+
+	AdminRequests.WithLabelValues(op, status).Inc()
+	AdminDuration.WithLabelValues(op, status).Observe(time.Since(start).Seconds())
+
+	return resp, err
+}
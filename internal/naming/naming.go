@@ -0,0 +1,215 @@
+// Package naming renders Garage key names and bucket aliases from COSI metadata
+// with user-defined templates.
+package naming
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+const (
+	// maxKeyNameLength is the maximum length of a rendered Garage key name.
+	maxKeyNameLength = 255
+
+	// maxBucketAliasLength is the maximum length of an S3 bucket name.
+	maxBucketAliasLength = 63
+
+	// bucketAliasHashLength is the length of the hash suffix of shortened bucket aliases.
+	bucketAliasHashLength = 8
+)
+
+// bucketAliasPattern matches valid S3 bucket names.
+var bucketAliasPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// KeyNameData is the data available in a key name template.
+type KeyNameData struct {
+	DriverName  string
+	BucketID    string
+	AccountName string
+}
+
+// bucketAliasData is the data available in a bucket alias template.
+type bucketAliasData struct {
+	ClusterName string
+	DriverName  string
+	Name        string
+}
+
+// nameTemplate renders Garage names from COSI metadata.
+type nameTemplate struct {
+	tmpl *template.Template
+}
+
+// parseNameTemplate parses a name template.
+func parseNameTemplate(name, text string) (*nameTemplate, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &nameTemplate{tmpl: tmpl}, nil
+}
+
+// execute renders the template with the given data.
+func (t *nameTemplate) execute(data any) (string, error) {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// KeyNameTemplate renders Garage key names.
+type KeyNameTemplate struct {
+	*nameTemplate
+}
+
+// NewKeyNameTemplate parses a key name template and validates it with sample data.
+func NewKeyNameTemplate(text string) (*KeyNameTemplate, error) {
+	tmpl, err := parseNameTemplate("keyName", text)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &KeyNameTemplate{tmpl}
+
+	// Validate with realistically sized sample data: a 32 byte hexadecimal bucket ID
+	// and a COSI account name, which is prefixed with "ba-" followed by a UUID.
+	sample := KeyNameData{
+		DriverName:  "garage.objectstorage.k8s.io",
+		BucketID:    strings.Repeat("0", 64),
+		AccountName: "ba-00000000-0000-0000-0000-000000000000",
+	}
+
+	name, err := t.Render(sample)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys are looked up by name, so every BucketAccess of a bucket needs its own name.
+	sample.AccountName = "ba-11111111-1111-1111-1111-111111111111"
+
+	other, err := t.Render(sample)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == other {
+		return nil, errors.New("key name must depend on .AccountName")
+	}
+
+	return t, nil
+}
+
+// Render returns the key name for the given data.
+func (t *KeyNameTemplate) Render(data KeyNameData) (string, error) {
+	name, err := t.execute(data)
+	if err != nil {
+		return "", err
+	}
+
+	if name == "" {
+		return "", errors.New("key name cannot be empty")
+	}
+
+	if len(name) > maxKeyNameLength {
+		return "", fmt.Errorf("key name %q exceeds %d characters", name, maxKeyNameLength)
+	}
+
+	return name, nil
+}
+
+// BucketAliasTemplate renders Garage bucket global aliases.
+type BucketAliasTemplate struct {
+	*nameTemplate
+	clusterName string
+	driverName  string
+}
+
+// NewBucketAliasTemplate parses a bucket alias template and validates it with sample data.
+func NewBucketAliasTemplate(text, clusterName, driverName string) (*BucketAliasTemplate, error) {
+	tmpl, err := parseNameTemplate("bucketAlias", text)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &BucketAliasTemplate{
+		nameTemplate: tmpl,
+		clusterName:  clusterName,
+		driverName:   driverName,
+	}
+
+	// Validate with a COSI bucket name, which is the BucketClass name followed by a UUID.
+	alias, err := t.Render("garage00000000-0000-0000-0000-000000000000")
+	if err != nil {
+		return nil, err
+	}
+
+	// Existing buckets are looked up by alias, so every BucketClaim needs its own alias.
+	other, err := t.Render("garage11111111-1111-1111-1111-111111111111")
+	if err != nil {
+		return nil, err
+	}
+
+	if alias == other {
+		return nil, errors.New("bucket alias must depend on .Name")
+	}
+
+	return t, nil
+}
+
+// Render returns the bucket alias for a COSI bucket name.
+// Aliases exceeding the S3 bucket name length are shortened deterministically with a hash suffix.
+func (t *BucketAliasTemplate) Render(name string) (string, error) {
+	alias, err := t.execute(bucketAliasData{
+		ClusterName: t.clusterName,
+		DriverName:  t.driverName,
+		Name:        name,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(alias) > maxBucketAliasLength {
+		sum := sha256.Sum256([]byte(alias))
+		prefix := strings.TrimRight(alias[:maxBucketAliasLength-bucketAliasHashLength-1], ".-")
+		alias = prefix + "-" + hex.EncodeToString(sum[:])[:bucketAliasHashLength]
+	}
+
+	if !bucketAliasPattern.MatchString(alias) || strings.Contains(alias, "..") || net.ParseIP(alias) != nil {
+		return "", fmt.Errorf("bucket alias %q is not a valid S3 bucket name", alias)
+	}
+
+	return alias, nil
+}
+
+// Prefix returns the constant beginning of all bucket aliases up to the COSI bucket name.
+// It is empty if the template starts with the name.
+func (t *BucketAliasTemplate) Prefix() (string, error) {
+	const marker = "\x00"
+
+	alias, err := t.execute(bucketAliasData{
+		ClusterName: t.clusterName,
+		DriverName:  t.driverName,
+		Name:        marker,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	prefix, _, _ := strings.Cut(alias, marker)
+
+	// Shortened aliases keep only the beginning of the rendered alias.
+	if n := maxBucketAliasLength - bucketAliasHashLength - 1; len(prefix) > n {
+		prefix = strings.TrimRight(prefix[:n], ".-")
+	}
+
+	return prefix, nil
+}
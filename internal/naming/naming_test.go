@@ -0,0 +1,133 @@
+package naming
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewKeyNameTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{"default", "{{.AccountName}}", ""},
+		{"all fields", "cosi-{{.DriverName}}-{{.BucketID}}-{{.AccountName}}", ""},
+		{"without account name", "cosi-{{.DriverName}}-{{.BucketID}}", "must depend on .AccountName"},
+		{"constant", "cosi", "must depend on .AccountName"},
+		{"unknown field", "{{.Bucket}}", "can't evaluate field Bucket"},
+		{"syntax error", "{{.AccountName", "unclosed action"},
+		{"empty", "{{if false}}{{.AccountName}}{{end}}", "cannot be empty"},
+		{"too long", strings.Repeat("x", maxKeyNameLength) + "{{.AccountName}}", "exceeds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyNameTemplate(tt.text)
+
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("got error %v, want none", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewBucketAliasTemplate(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		clusterName string
+		wantErr     string
+	}{
+		{"default", "{{.Name}}", "", ""},
+		{"cluster name", "{{.ClusterName}}-{{.Name}}", "prod", ""},
+		{"without name", "{{.ClusterName}}", "prod", "must depend on .Name"},
+		{"constant", "bucket", "", "must depend on .Name"},
+		{"empty cluster name", "{{.ClusterName}}-{{.Name}}", "", "not a valid S3 bucket name"},
+		{"unknown field", "{{.Bucket}}", "", "can't evaluate field Bucket"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewBucketAliasTemplate(tt.text, tt.clusterName, "garage.objectstorage.k8s.io")
+
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("got error %v, want none", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBucketAliasTemplateRender(t *testing.T) {
+	tmpl, err := NewBucketAliasTemplate("{{.Name}}", "", "garage.objectstorage.k8s.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		bucket  string
+		want    string
+		wantErr bool
+	}{
+		{"unchanged", "bucket-1.data", "bucket-1.data", false},
+		{"maximum length", strings.Repeat("a", 63), strings.Repeat("a", 63), false},
+		{"shortened", strings.Repeat("a", 64), strings.Repeat("a", 54) + "-ffe054fe", false},
+		{"shortened with trailing dash", strings.Repeat("a", 53) + "-" + strings.Repeat("b", 20), strings.Repeat("a", 53) + "-af3ec493", false},
+		{"shortened with trailing dot and dash", strings.Repeat("a", 52) + ".-" + strings.Repeat("b", 20), strings.Repeat("a", 52) + "-2f2c092f", false},
+		{"too short", "ab", "", true},
+		{"uppercase", "Bucket", "", true},
+		{"leading dash", "-bucket", "", true},
+		{"trailing dot", "bucket.", "", true},
+		{"consecutive dots", "bucket..data", "", true},
+		{"IP address", "192.168.1.1", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tmpl.Render(tt.bucket)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("got alias %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBucketAliasTemplatePrefix(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"{{.Name}}", ""},
+		{"cosi-{{.Name}}", "cosi-"},
+		{"{{.ClusterName}}-{{.Name}}-data", "prod-"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			tmpl, err := NewBucketAliasTemplate(tt.text, "prod", "garage.objectstorage.k8s.io")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := tmpl.Prefix()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got prefix %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
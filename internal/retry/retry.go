@@ -0,0 +1,60 @@
+// Package retry implements retries with exponential backoff and jitter
+// for calls to the Garage admin API.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// ErrDeadline is returned if the next attempt would start after the context deadline.
+var ErrDeadline = errors.New("retry would exceed context deadline")
+
+// Policy configures retries with exponential backoff and jitter.
+type Policy struct {
+	// MaxAttempts is the maximum number of attempts including the first one.
+	MaxAttempts int
+	// InitialBackoff is the upper bound of the wait time before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the upper bound of the wait time between attempts.
+	MaxBackoff time.Duration
+}
+
+// Backoff returns the wait time before the given retry, starting at 1.
+// The wait time is chosen randomly up to an exponentially growing bound ("full jitter").
+func (p Policy) Backoff(retry int) time.Duration {
+	bound := p.InitialBackoff
+	for i := 1; i < retry && bound < p.MaxBackoff; i++ {
+		bound *= 2
+	}
+
+	bound = min(bound, p.MaxBackoff)
+	if bound <= 0 {
+		return 0
+	}
+
+	return rand.N(bound)
+}
+
+// Wait blocks for the backoff of the given retry, starting at 1.
+// It returns early with an error if the context is done, and immediately
+// with ErrDeadline if the context deadline would pass before the wait ends.
+func (p Policy) Wait(ctx context.Context, retry int) error {
+	d := p.Backoff(retry)
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return ErrDeadline
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,84 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// Transport is a http.RoundTripper retrying idempotent requests on
+// connection errors and server errors.
+type Transport struct {
+	Next   http.RoundTripper
+	Policy Policy
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.retryable(req) {
+		return t.Next.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+
+	var resp *http.Response
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		resp, err = t.Next.RoundTrip(req)
+		if !shouldRetry(ctx, resp, err) || attempt >= t.Policy.MaxAttempts {
+			return resp, err
+		}
+
+		if t.Policy.Wait(ctx, attempt) != nil {
+			return resp, err
+		}
+
+		// Discard the failed response and rewind the request body.
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+// retryable returns true if the request can be sent more than once.
+func (t *Transport) retryable(req *http.Request) bool {
+	if t.Policy.MaxAttempts <= 1 {
+		return false
+	}
+
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// shouldRetry returns true for connection errors and server errors.
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	return resp.StatusCode >= http.StatusInternalServerError
+}
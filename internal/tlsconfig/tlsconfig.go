@@ -0,0 +1,204 @@
+// Package tlsconfig provides TLS client configurations for the Garage admin API,
+// which reload certificates when the underlying files change.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/mpreu/cosi-driver-garage/internal/watch"
+)
+
+// Options for the TLS client configuration.
+type Options struct {
+	// CAFile is a PEM bundle of CAs to verify the server. System roots are used if empty.
+	CAFile string
+	// CertFile and KeyFile are a PEM client certificate and key for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the server name used for verification.
+	ServerName string
+	// Host is the host of the admin endpoint, which is verified if ServerName is empty.
+	Host string
+	// MinVersion is the minimum TLS version.
+	MinVersion uint16
+	// InsecureSkipVerify disables server certificate verification.
+	InsecureSkipVerify bool
+}
+
+// versions maps supported TLS version names to their values.
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseVersion parses a TLS version like "1.2".
+func ParseVersion(v string) (uint16, error) {
+	version, ok := versions[v]
+	if !ok {
+		return 0, fmt.Errorf("unsupported TLS version %q", v)
+	}
+
+	return version, nil
+}
+
+// Reloader holds the current CA pool and client certificate.
+type Reloader struct {
+	opts   Options
+	logger *slog.Logger
+
+	mu    sync.RWMutex
+	roots *x509.CertPool
+	cert  *tls.Certificate
+}
+
+// New returns a Reloader with the files loaded initially.
+func New(opts Options, logger *slog.Logger) (*Reloader, error) {
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, errors.New("client certificate and key files must be set together")
+	}
+
+	r := &Reloader{
+		opts:   opts,
+		logger: logger,
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload loads the CA bundle and the client certificate again.
+// On error the previously loaded files stay in use.
+func (r *Reloader) Reload() error {
+	var roots *x509.CertPool
+	if r.opts.CAFile != "" {
+		pem, err := os.ReadFile(r.opts.CAFile)
+		if err != nil {
+			return fmt.Errorf("error reading CA file: %w", err)
+		}
+
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return errors.New("error parsing CA file: no certificates found")
+		}
+	}
+
+	var cert *tls.Certificate
+	if r.opts.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+		if err != nil {
+			return fmt.Errorf("error loading client certificate: %w", err)
+		}
+
+		cert = &c
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.roots = roots
+	r.cert = cert
+
+	return nil
+}
+
+// Watch reloads the files whenever they change, until the context is done.
+func (r *Reloader) Watch(ctx context.Context) error {
+	var files []string
+	for _, f := range []string{r.opts.CAFile, r.opts.CertFile, r.opts.KeyFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+
+	if len(files) == 0 {
+		return nil
+	}
+
+	return watch.Files(ctx, files, func() {
+		if err := r.Reload(); err != nil {
+			r.logger.Error("Failed to reload TLS files, keeping previous ones", "error", err)
+			return
+		}
+
+		r.logger.Info("Reloaded TLS files")
+	})
+}
+
+// Config returns a TLS client configuration using the current files for every handshake.
+func (r *Reloader) Config() *tls.Config {
+	c := &tls.Config{
+		ServerName:           r.opts.ServerName,
+		MinVersion:           r.opts.MinVersion,
+		InsecureSkipVerify:   r.opts.InsecureSkipVerify, //nolint:gosec
+		GetClientCertificate: r.clientCertificate,
+	}
+
+	// Without a CA file, the standard verification with the system roots is used.
+	if r.opts.CAFile != "" && !r.opts.InsecureSkipVerify {
+		// Verification is done in verifyConnection with the current CA pool.
+		c.InsecureSkipVerify = true
+		c.VerifyConnection = r.verifyConnection
+	}
+
+	return c
+}
+
+// verifyConnection verifies the server certificate chain and name.
+// The name is checked against the configured server name or endpoint host, since
+// the server name of the connection state is empty for IP addresses.
+func (r *Reloader) verifyConnection(cs tls.ConnectionState) error {
+	name := r.opts.ServerName
+	if name == "" {
+		name = r.opts.Host
+	}
+
+	if name == "" {
+		return errors.New("no server name to verify")
+	}
+
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+
+	r.mu.RLock()
+	roots := r.roots
+	r.mu.RUnlock()
+
+	intermediates := x509.NewCertPool()
+	for _, c := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       name,
+		Intermediates: intermediates,
+	})
+
+	return err
+}
+
+// clientCertificate returns the current client certificate.
+func (r *Reloader) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.cert == nil {
+		// An empty certificate signals that no client certificate is available.
+		return &tls.Certificate{}, nil
+	}
+
+	return r.cert, nil
+}
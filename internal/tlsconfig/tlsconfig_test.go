@@ -0,0 +1,177 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA is a certificate authority issuing server certificates for tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newTestCA returns a self-signed certificate authority.
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns a server certificate for the given DNS names and IP addresses.
+func (ca *testCA) issue(t *testing.T, dnsNames []string, ips []net.IP) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "server"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestReloaderConfig(t *testing.T) {
+	ca := newTestCA(t)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, ca.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	localhost := []net.IP{net.ParseIP("127.0.0.1")}
+
+	tests := []struct {
+		name    string
+		cert    tls.Certificate
+		opts    Options
+		wantErr bool
+	}{
+		{
+			name: "IP SAN",
+			cert: ca.issue(t, nil, localhost),
+			opts: Options{CAFile: caFile, Host: "127.0.0.1"},
+		},
+		{
+			name:    "IP endpoint without IP SAN",
+			cert:    ca.issue(t, []string{"other.example"}, nil),
+			opts:    Options{CAFile: caFile, Host: "127.0.0.1"},
+			wantErr: true,
+		},
+		{
+			name: "server name override",
+			cert: ca.issue(t, []string{"other.example"}, nil),
+			opts: Options{CAFile: caFile, Host: "127.0.0.1", ServerName: "other.example"},
+		},
+		{
+			name:    "wrong server name override",
+			cert:    ca.issue(t, nil, localhost),
+			opts:    Options{CAFile: caFile, Host: "127.0.0.1", ServerName: "other.example"},
+			wantErr: true,
+		},
+		{
+			name:    "untrusted CA",
+			cert:    newTestCA(t).issue(t, nil, localhost),
+			opts:    Options{CAFile: caFile, Host: "127.0.0.1"},
+			wantErr: true,
+		},
+		{
+			name:    "system roots",
+			cert:    ca.issue(t, nil, localhost),
+			opts:    Options{Host: "127.0.0.1"},
+			wantErr: true,
+		},
+		{
+			name: "insecure skip verify",
+			cert: ca.issue(t, []string{"other.example"}, nil),
+			opts: Options{CAFile: caFile, Host: "127.0.0.1", InsecureSkipVerify: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			srv.TLS = &tls.Config{Certificates: []tls.Certificate{tt.cert}}
+			srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+			srv.StartTLS()
+			defer srv.Close()
+
+			r, err := New(tt.opts, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c := &http.Client{Transport: &http.Transport{TLSClientConfig: r.Config()}}
+
+			resp, err := c.Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
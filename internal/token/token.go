@@ -0,0 +1,88 @@
+// Package token provides the Garage admin API token from a file,
+// which is reloaded when the file changes.
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/mpreu/cosi-driver-garage/internal/watch"
+)
+
+// File holds the current admin token read from a file.
+type File struct {
+	path   string
+	logger *slog.Logger
+
+	mu    sync.RWMutex
+	token string
+}
+
+// NewFile returns a File with the token loaded initially.
+func NewFile(path string, logger *slog.Logger) (*File, error) {
+	f := &File{
+		path:   path,
+		logger: logger,
+	}
+
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Reload reads the token from the file again.
+// On error the previous token stays in use.
+func (f *File) Reload() error {
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("error reading admin token file: %w", err)
+	}
+
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return errors.New("admin token file is empty")
+	}
+
+	if strings.IndexFunc(token, func(r rune) bool { return unicode.IsSpace(r) || !unicode.IsPrint(r) }) >= 0 {
+		return errors.New("admin token contains invalid characters")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.token = token
+
+	return nil
+}
+
+// Watch reloads the token whenever the file changes, until the context is done.
+func (f *File) Watch(ctx context.Context) error {
+	return watch.Files(ctx, []string{f.path}, func() {
+		if err := f.Reload(); err != nil {
+			f.logger.Error("Failed to reload admin token, keeping previous one", "error", err)
+			return
+		}
+
+		f.logger.Info("Reloaded admin token")
+	})
+}
+
+// Intercept adds the current token as bearer token to a request.
+// It can be used as request editor of the Garage client.
+func (f *File) Intercept(_ context.Context, req *http.Request) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	req.Header.Set("Authorization", "Bearer "+f.token)
+
+	return nil
+}
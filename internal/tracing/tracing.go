@@ -0,0 +1,138 @@
+// Package tracing configures OpenTelemetry tracing of COSI requests and Garage admin API calls.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"google.golang.org/grpc"
+
+	"github.com/mpreu/cosi-driver-garage/internal/client"
+	"github.com/mpreu/cosi-driver-garage/internal/config"
+)
+
+// serviceName is the default service name of exported spans.
+const serviceName = "cosi-driver-garage"
+
+// shutdownTimeout bounds flushing spans at shutdown.
+const shutdownTimeout = 5 * time.Second
+
+// Setup installs the global tracer provider and propagator for the configured exporter.
+// The OTLP exporter, the service name and the sampler are further configured with the
+// standard OTEL_* environment variables. The returned function flushes pending spans.
+func Setup(ctx context.Context, cfg *config.Config, logger *slog.Logger) (func(), error) {
+	if cfg.TracingExporter == config.TracingExporterNone {
+		return func() {}, nil
+	}
+
+	exporter, closer, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Later detectors override the default service name, e.g. with OTEL_SERVICE_NAME.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating tracing resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Error("Failed to export traces", "error", err)
+	}))
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+		defer cancel()
+
+		if err := errors.Join(tp.Shutdown(ctx), closer.Close()); err != nil {
+			logger.Error("Failed to shut down tracing", "error", err)
+		}
+	}, nil
+}
+
+// nopCloser is returned for exporters without a file.
+type nopCloser struct{}
+
+// Close implements io.Closer.
+func (nopCloser) Close() error {
+	return nil
+}
+
+// newExporter returns the configured span exporter and a closer for its output file.
+func newExporter(ctx context.Context, cfg *config.Config) (sdktrace.SpanExporter, io.Closer, error) {
+	switch cfg.TracingExporter {
+	case config.TracingExporterOTLP:
+		exporter, err := otlptracegrpc.New(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error creating OTLP trace exporter: %w", err)
+		}
+
+		return exporter, nopCloser{}, nil
+	case config.TracingExporterStdout:
+		exporter, err := stdouttrace.New()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error creating stdout trace exporter: %w", err)
+		}
+
+		return exporter, nopCloser{}, nil
+	case config.TracingExporterFile:
+		f, err := os.OpenFile(cfg.TracingFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error opening trace file: %w", err)
+		}
+
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			return nil, nil, errors.Join(fmt.Errorf("error creating file trace exporter: %w", err), f.Close())
+		}
+
+		return exporter, f, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported trace exporter %q", cfg.TracingExporter)
+	}
+}
+
+// ServerOption returns a gRPC server option creating a span for each request.
+// The trace context is propagated from the request metadata.
+func ServerOption() grpc.ServerOption {
+	return grpc.StatsHandler(otelgrpc.NewServerHandler())
+}
+
+// Transport returns a http.RoundTripper creating a span for each Garage admin API call,
+// named after its operation.
+func Transport(next http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(next,
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return "garage." + client.Operation(r)
+		}),
+	)
+}
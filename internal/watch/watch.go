@@ -0,0 +1,57 @@
+// Package watch notifies about changes of mounted files.
+package watch
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Files calls onChange whenever one of the files might have changed, until the context is done.
+// The parent directories are watched, so the atomic symlink swaps used by Kubernetes
+// for mounted Secrets and ConfigMaps are detected as well.
+func Files(ctx context.Context, paths []string, onChange func()) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	dirs := map[string]bool{}
+	for _, p := range paths {
+		dir := filepath.Dir(p)
+		if dirs[dir] {
+			continue
+		}
+
+		if err := w.Add(dir); err != nil {
+			w.Close()
+			return err
+		}
+
+		dirs[dir] = true
+	}
+
+	go func() {
+		defer w.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-w.Events:
+				if !ok {
+					return
+				}
+
+				onChange()
+			case _, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+
+	return nil
+}